@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rollcat/dua/scan"
+)
+
+const (
+	day  = 24 * time.Hour
+	week = 7 * day
+	year = 365 * day
+)
+
+// ageBucket is a bar of the age histogram (--by age), holding the
+// entries younger than its limit.
+type ageBucket struct {
+	label string
+	limit time.Duration
+}
+
+var ageBuckets = []ageBucket{
+	{"< 1 day", day},
+	{"1 day - 1 week", week},
+	{"1 week - 1 month", 30 * day},
+	{"1 - 3 months", 91 * day},
+	{"3 - 6 months", 182 * day},
+	{"6 - 12 months", year},
+	{"1 - 2 years", 2 * year},
+	{"2 - 5 years", 5 * year},
+	{"> 5 years", 1<<63 - 1},
+}
+
+// parseAge parses a positive age such as "180d", "12w" or "2y", or any
+// duration accepted by time.ParseDuration.
+func parseAge(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	units := map[string]time.Duration{"d": day, "w": week, "y": year}
+	for suffix, unit := range units {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			// Ages which do not fit in a Duration are invalid.
+			f, ferr := strconv.ParseFloat(n, 64)
+			if ferr == nil && math.Abs(f*float64(unit)) < 1<<63 {
+				d, err = time.Duration(f*float64(unit)), nil
+			}
+		}
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid age %q (e.g. 180d, 12w, 2y, 36h)", s)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("age %q must be greater than 0", s)
+	}
+	return d, nil
+}
+
+// ageTime returns the time by which the age of s is judged: when it
+// was last modified, or with --atime, last accessed.
+func ageTime(s *scan.NodeStat) time.Time {
+	if useAtime {
+		return s.AccessTime()
+	}
+	return s.ModTime()
+}
+
+// ageKey returns the label of the age bucket of s, as of now.
+func ageKey(now time.Time) func(*scan.NodeStat) string {
+	return func(s *scan.NodeStat) string {
+		age := now.Sub(ageTime(s))
+		for _, b := range ageBuckets {
+			if age < b.limit {
+				return b.label
+			}
+		}
+		return ageBuckets[len(ageBuckets)-1].label
+	}
+}
+
+// ageHistogram returns the groups by age bucket, youngest first,
+// rather than by size; including the empty ones.
+func ageHistogram(groups []scan.Group) []scan.Group {
+	histogram := make([]scan.Group, len(ageBuckets))
+	for i, b := range ageBuckets {
+		histogram[i].Key = b.label
+		if j := slices.IndexFunc(groups, func(g scan.Group) bool { return g.Key == b.label }); j >= 0 {
+			histogram[i] = groups[j]
+		}
+	}
+	return histogram
+}
+
+// olderThan returns a function reporting whether s is a file (or any
+// other entry, except for a directory) not touched since cutoff.
+func olderThan(cutoff time.Time) func(*scan.NodeStat) bool {
+	return func(s *scan.NodeStat) bool {
+		return s.Type() != "d" && s.Type() != " " && ageTime(s).Before(cutoff)
+	}
+}
+
+// staleTotals maps the path of every entry in the tree under stale,
+// as returned by scan.Filter, to its total.
+func staleTotals(stale *scan.NodeStat) map[string]int64 {
+	totals := map[string]int64{}
+	var walk func(s *scan.NodeStat)
+	walk = func(s *scan.NodeStat) {
+		totals[s.Path()] = s.Total()
+		for _, child := range s.Children() {
+			walk(child)
+		}
+	}
+	walk(stale)
+	return totals
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rollcat/dua/scan"
+)
+
+// checkTop is the number of top contributors shown for every budget
+// which is exceeded.
+const checkTop = 5
+
+// A budget limits the total size, or the number of files, of the
+// entries matching a pattern.
+type budget struct {
+	line     string // as written in the budget file
+	pattern  string
+	maxBytes int64 // or -1
+	maxFiles int64 // or -1
+}
+
+// readBudget reads a budget file for "dua check": one budget per
+// line, as a pattern, "<=", and either a size or a number of files:
+//
+//	build/** <= 2GB
+//	logs <= 10000 files
+//
+// Blank lines and lines starting with "#" are ignored.
+func readBudget(name string) ([]budget, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var budgets []budget
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pattern, limit, ok := strings.Cut(line, "<=")
+		b := budget{
+			line:     line,
+			pattern:  strings.TrimSpace(pattern),
+			maxBytes: -1,
+			maxFiles: -1,
+		}
+		limit = strings.TrimSpace(limit)
+		if files, ok := strings.CutSuffix(limit, "files"); ok {
+			b.maxFiles, err = strconv.ParseInt(strings.TrimSpace(files), 10, 64)
+		} else {
+			b.maxBytes, err = parseSize(limit)
+		}
+		if !ok || b.pattern == "" || err != nil {
+			return nil, fmt.Errorf("%s:%d: expected PATTERN <= SIZE, or PATTERN <= N files", name, n)
+		}
+		budgets = append(budgets, b)
+	}
+	return budgets, scanner.Err()
+}
+
+// checkBudgets compares the entries under root to the budgets, prints
+// the outcome of each, and returns the number of budgets which failed:
+// those exceeded, and those whose pattern matches nothing (most likely
+// a typo, which would otherwise go unnoticed).
+func checkBudgets(root *scan.NodeStat, budgets []budget) (int, error) {
+	exceeded := 0
+	for _, b := range budgets {
+		matches, err := scan.Match(root, b.pattern)
+		if err != nil {
+			return 0, err
+		}
+		if len(matches) == 0 {
+			exceeded++
+			println(fmt.Sprintf("NONE  %s (no matching entries)", b.line))
+			continue
+		}
+		var bytes, files int64
+		for _, s := range matches {
+			bytes += s.Total()
+			files += s.Files()
+		}
+		var usage string
+		ok := true
+		if b.maxFiles >= 0 {
+			usage = fmtCount(files) + " files"
+			ok = files <= b.maxFiles
+		} else {
+			usage = strings.TrimSpace(fmtBytes(bytes))
+			ok = bytes <= b.maxBytes
+		}
+		if ok {
+			println(fmt.Sprintf("ok    %s (%s)", b.line, usage))
+			continue
+		}
+		exceeded++
+		println(fmt.Sprintf("FAIL  %s (%s)", b.line, usage))
+		var top []*scan.NodeStat
+		for _, s := range matches {
+			top = append(top, scan.Top(s, checkTop, threshold)...)
+		}
+		slices.SortStableFunc(top, func(x, y *scan.NodeStat) int {
+			if b.maxFiles >= 0 {
+				return cmp.Compare(y.Files(), x.Files())
+			}
+			return cmp.Compare(y.Total(), x.Total())
+		})
+		for _, s := range top[:min(checkTop, len(top))] {
+			if b.maxFiles >= 0 {
+				println(fmt.Sprintf("      %s (%s files)", format(s), fmtCount(s.Files())))
+			} else {
+				println("      " + format(s))
+			}
+		}
+	}
+	return exceeded, nil
+}
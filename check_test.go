@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/rollcat/dua/scan"
+)
+
+func writeFile(t *testing.T, data string) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "budget.txt")
+	if err := os.WriteFile(name, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestReadBudget(t *testing.T) {
+	budgets, err := readBudget(writeFile(t, `
+# The whole checkout.
+.            <= 10GB
+build/**     <= 1.5 MB
+logs         <= 10000 files
+tmp<=0
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []budget{
+		{line: ".            <= 10GB", pattern: ".", maxBytes: 10 * GB, maxFiles: -1},
+		{line: "build/**     <= 1.5 MB", pattern: "build/**", maxBytes: 1.5 * MB, maxFiles: -1},
+		{line: "logs         <= 10000 files", pattern: "logs", maxBytes: -1, maxFiles: 10000},
+		{line: "tmp<=0", pattern: "tmp", maxBytes: 0, maxFiles: -1},
+	}
+	if !slices.Equal(budgets, want) {
+		t.Errorf("got %+v, want %+v", budgets, want)
+	}
+}
+
+func TestReadBudgetInvalid(t *testing.T) {
+	for _, line := range []string{
+		"build/**",
+		"build/** 2GB",
+		"<= 2GB",
+		"build/** <= ",
+		"build/** <= lots",
+		"build/** <= -1GB",
+		"logs <= many files",
+	} {
+		if _, err := readBudget(writeFile(t, line+"\n")); err == nil {
+			t.Errorf("%q: no error", line)
+		}
+	}
+}
+
+func TestCheckBudgets(t *testing.T) {
+	sc, err := scan.NewScanner(scan.Options{ApparentSize: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := sc.ScanFS(fstest.MapFS{
+		"root/build/a":    {Data: make([]byte, 1000)},
+		"root/build/b":    {Data: make([]byte, 1000)},
+		"root/src/logs/1": {Data: make([]byte, 10)},
+		"root/logs/2":     {Data: make([]byte, 10)},
+		"root/logs/3":     {Data: make([]byte, 10)},
+	}, "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		budget string
+		failed int
+	}{
+		{". <= 3KB", 0},
+		{". <= 2000", 1},
+		{"build/** <= 2000", 0},
+		{"build/** <= 1999", 1},
+		{"logs <= 3 files", 0},
+		{"logs <= 2 files", 1},
+		{"buld/** <= 2GB", 1},
+	} {
+		budgets, err := readBudget(writeFile(t, tt.budget))
+		if err != nil {
+			t.Fatal(err)
+		}
+		failed, err := checkBudgets(result.Root, budgets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if failed != tt.failed {
+			t.Errorf("%q: %d failed, want %d", tt.budget, failed, tt.failed)
+		}
+	}
+}
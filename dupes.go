@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/rollcat/dua/scan"
+)
+
+// printDupes prints the first n sets of duplicate files, e.g.:
+//
+//	1.20 GB reclaimable, 3 copies of 614.40 MB:
+//	  /srv/a/data.bin
+//	  ...
+func printDupes(sets []scan.DupeSet, n int) {
+	var total int64
+	for _, d := range sets {
+		total += d.Reclaimable()
+	}
+	for _, d := range sets[:min(n, len(sets))] {
+		println(fmt.Sprintf("%s reclaimable, %d copies of %s:",
+			fmtBytes(d.Reclaimable()), len(d.Files), strings.TrimSpace(fmtBytes(d.Size()))))
+		for _, s := range d.Files {
+			println("    " + s.Path())
+		}
+	}
+	println(fmt.Sprintf("Total: %s reclaimable in %s sets of duplicates",
+		strings.TrimSpace(fmtBytes(total)), fmtCount(len(sets))))
+}
+
+// writeDupesJSON writes the first n sets of duplicate files to w.
+func writeDupesJSON(w io.Writer, sets []scan.DupeSet, root *scan.NodeStat, n int) error {
+	type jsonDupeSet struct {
+		Bytes       int64    `json:"bytes"`
+		Reclaimable int64    `json:"reclaimable"`
+		Paths       []string `json:"paths"`
+	}
+	out := struct {
+		Version int           `json:"version"`
+		Root    jsonNode      `json:"root"`
+		Dupes   []jsonDupeSet `json:"dupes"`
+	}{
+		Version: jsonVersion,
+		Root:    newJSONNode(root, root),
+		Dupes:   make([]jsonDupeSet, 0, min(n, len(sets))),
+	}
+	for _, d := range sets[:min(n, len(sets))] {
+		set := jsonDupeSet{Bytes: d.Size(), Reclaimable: d.Reclaimable()}
+		for _, s := range d.Files {
+			set.Paths = append(set.Paths, s.Path())
+		}
+		out.Dupes = append(out.Dupes, set)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// summarizeErrors describes errs in a single line, e.g.:
+//
+//	1,203 entries unreadable (permission denied: 1,190, ...)
+func summarizeErrors(errs []*fs.PathError) string {
+	noun := "entries"
+	if len(errs) == 1 {
+		noun = "entry"
+	}
+	return fmt.Sprintf("%s %s unreadable (%s)", fmtCount(len(errs)), noun, reasons(errs))
+}
+
+// summarizeUnlisted describes the archives which could not be listed
+// in a single line, e.g.:
+//
+//	2 archives not listed (zip: not a valid zip file: 2)
+func summarizeUnlisted(errs []*fs.PathError) string {
+	noun := "archives"
+	if len(errs) == 1 {
+		noun = "archive"
+	}
+	return fmt.Sprintf("%s %s not listed (%s)", fmtCount(len(errs)), noun, reasons(errs))
+}
+
+// reasons lists the distinct errors in errs, most common first, with
+// the number of each.
+func reasons(errs []*fs.PathError) string {
+	counts := map[string]int{}
+	for _, err := range errs {
+		counts[err.Err.Error()]++
+	}
+	reasons := make([]string, 0, len(counts))
+	for reason := range counts {
+		reasons = append(reasons, reason)
+	}
+	slices.SortFunc(reasons, func(a, b string) int {
+		if counts[a] != counts[b] {
+			return counts[b] - counts[a]
+		}
+		return strings.Compare(a, b)
+	})
+	for i, reason := range reasons {
+		reasons[i] = fmt.Sprintf("%s: %s", reason, fmtCount(counts[reason]))
+	}
+	return strings.Join(reasons, ", ")
+}
+
+// writeErrors writes errs to the named file, one per line, as
+// tab-separated operation, error and path.
+func writeErrors(name string, errs []*fs.PathError) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, err := range errs {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", err.Op, err.Err, err.Path)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// fmtCount formats n with thousands separators.
+func fmtCount[I ~int | ~int64](n I) string {
+	s := strconv.FormatInt(int64(n), 10)
+	start := 0
+	if n < 0 {
+		start = 1
+	}
+	for i := len(s) - 3; i > start; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
@@ -2,4 +2,10 @@ module github.com/rollcat/dua
 
 go 1.21.5
 
-require github.com/rollcat/getopt v0.0.0-20230716181956-07db84dc9826 // indirect
+require (
+	github.com/klauspost/compress v1.17.11
+	github.com/rollcat/getopt v0.0.0-20230716181956-07db84dc9826
+	golang.org/x/term v0.20.0
+)
+
+require golang.org/x/sys v0.20.0 // indirect
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"time"
+
+	"github.com/rollcat/dua/scan"
+)
+
+// groupKeys lists the values of --by.
+var groupKeys = []string{"ext", "category", "owner", "group", "age"}
+
+// groupKey returns the function giving the key to group files by, for
+// the given value of --by. Extensions missing from categories fall
+// back to scan.DefaultCategories.
+func groupKey(by string, categories map[string]string) func(*scan.NodeStat) string {
+	switch by {
+	case "ext":
+		return func(s *scan.NodeStat) string {
+			if ext := scan.Ext(s); ext != "" {
+				return ext
+			}
+			return "(none)"
+		}
+	case "category":
+		all := maps.Clone(scan.DefaultCategories)
+		maps.Copy(all, categories)
+		return func(s *scan.NodeStat) string {
+			if category, ok := all[scan.Ext(s)]; ok {
+				return category
+			}
+			return "(other)"
+		}
+	case "owner":
+		return ownerName
+	case "group":
+		return groupName
+	case "age":
+		return ageKey(time.Now())
+	}
+	panic("unexpected group key")
+}
+
+// printGroups prints the first n groups, with their share of the
+// total of root.
+func printGroups(groups []scan.Group, root *scan.NodeStat, n int) {
+	for _, g := range groups[:min(n, len(groups))] {
+		println(fmt.Sprintf("%s %5.1f%% %10s files  %s",
+			fmtBytes(g.Bytes), groupPercent(g, root), fmtCount(g.Files), g.Key))
+	}
+}
+
+// writeGroupsJSON writes the first n groups to w.
+func writeGroupsJSON(w io.Writer, groups []scan.Group, root *scan.NodeStat, n int) error {
+	type jsonGroup struct {
+		Key     string  `json:"key"`
+		Bytes   int64   `json:"bytes"`
+		Files   int64   `json:"files"`
+		Percent float64 `json:"percent"`
+	}
+	out := struct {
+		Version int         `json:"version"`
+		Root    jsonNode    `json:"root"`
+		Groups  []jsonGroup `json:"groups"`
+	}{
+		Version: jsonVersion,
+		Root:    newJSONNode(root, root),
+		Groups:  make([]jsonGroup, 0, min(n, len(groups))),
+	}
+	for _, g := range groups[:min(n, len(groups))] {
+		out.Groups = append(out.Groups, jsonGroup{g.Key, g.Bytes, g.Files, groupPercent(g, root)})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+func groupPercent(g scan.Group, root *scan.NodeStat) float64 {
+	if root.Total() == 0 {
+		return 0
+	}
+	return 100 * float64(g.Bytes) / float64(root.Total())
+}
@@ -1,18 +1,48 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	_ "io/fs"
 	"os"
-	"path"
+	"os/signal"
 	"slices"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/rollcat/dua/scan"
 	"github.com/rollcat/getopt"
 )
 
 var threshold float64 = 0.9
 var topn int = 20
+var showShared bool = false
+var excludeSummary bool = false
+var errorsFile string
+var outputFormat string = "text"
+var treeJSON bool = false
+var exportFile string
+var importFile string
+var interactive bool = false
+var saveFile string
+var diffFile string
+var incrementalFile string
+var timeout time.Duration
+var groupBy string
+var categories map[string]string
+var onlyUser string
+var useAtime bool = false
+var staleAge time.Duration
+var rankStale bool = false
+var findDupes bool = false
+var dupesMinSize int64 = MB
+var reclaimable bool = false
+var junkRules = scan.DefaultJunkRules
+var checkMode bool = false
+
+// stale maps paths to the size of entries under them, which are older
+// than staleAge.
+var stale map[string]int64
 
 const (
 	KB = 1024 << (iota * 10)
@@ -23,7 +53,21 @@ const (
 )
 
 func showUsage() {
-	println("Usage: dua [-h] [-t THRESHOLD] [-n N] <DIRECTORY>")
+	println(`Usage: dua [-hi] [-t THRESHOLD] [-n N] [-j JOBS] [-P|-H|-L] [--apparent-size]
+           [-l] [--shared] [-x] [--exclude PATTERN] [--exclude-from FILE]
+           [--exclude-summary] [--errors FILE] [--format FORMAT] [--tree-json]
+           [--export FILE] [--save FILE] [--diff OLD]
+           [--incremental SNAPSHOT [--verify]] [--timeout DURATION]
+           [--by KEY [--categories FILE]] [--user USER]
+           [--older-than AGE [--stale]] [--atime]
+           [--dupes [--min-size SIZE]] [--archives]
+           [--reclaimable [--junk-rules FILE]] <DIRECTORY | SNAPSHOT>
+       dua [-hi] [-t THRESHOLD] [-n N] [--apparent-size] [-l] [--shared]
+           [--format FORMAT] [--tree-json] [--by KEY [--categories FILE]]
+           [--user USER] [--older-than AGE [--stale]]
+           [--dupes [--min-size SIZE]] [--reclaimable [--junk-rules FILE]]
+           --import FILE
+       dua check [OPTIONS] BUDGET <DIRECTORY | SNAPSHOT | --import FILE>`)
 }
 
 func showHelp() {
@@ -34,8 +78,109 @@ for files and directories taking up the most space.
 
 Options:
     -h            Show this help and exit.
+    -i            Browse the results interactively.
     -t THRESHOLD  Set the threshold (default: 0.9; range (0.0 - 1.0)).
     -n N          Show top N results (default: 20).
+    -j JOBS       Scan up to JOBS directories in parallel
+                  (default: twice the number of CPUs).
+    -P            Never follow symbolic links; links are shown as [l]
+                  and counted by their own size (default).
+    -H            Follow symbolic links given on the command line.
+    -L            Follow all symbolic links.
+    --apparent-size
+                  Report apparent file sizes, rather than the space
+                  actually allocated on disk.
+    -l, --count-links
+                  Count hard-linked files once for every link, rather
+                  than only at the first path they were found under.
+    --shared      Also show how many bytes of each entry were not
+                  counted, because they are hard links to files
+                  counted elsewhere.
+    -x            Stay on the filesystem of DIRECTORY. Mount points
+                  of other filesystems are shown as [m], but not
+                  scanned.
+    --exclude PATTERN
+                  Skip entries matching the glob PATTERN. Patterns
+                  without a slash match the name at any depth; other
+                  patterns match the path under DIRECTORY, where "**"
+                  stands for any number of directories. Can be given
+                  multiple times.
+    --exclude-from FILE
+                  Read exclude patterns from FILE, one per line.
+    --exclude-summary
+                  Show how many entries were excluded.
+    --errors FILE Write the list of entries which could not be read
+                  to FILE.
+    --format FORMAT
+                  Print the results as "text" (default), or "json".
+    --tree-json   Print the whole scanned tree as JSON, rather than
+                  the top results.
+    --export FILE Also write the scanned tree to FILE, in the JSON
+                  format of "ncdu -o".
+    --import FILE Read the tree from FILE, as exported with "ncdu -o"
+                  or --export, rather than scanning a directory.
+    --save FILE   Also save the scanned tree to FILE, as a snapshot.
+                  Snapshots can be given instead of DIRECTORY, to show
+                  the results without scanning again.
+    --diff OLD    Show which entries grew and shrank the most, since
+                  the snapshot OLD was taken.
+    --incremental SNAPSHOT
+                  Only read directories which changed since SNAPSHOT
+                  was saved; take the entries of the others from
+                  SNAPSHOT. Files are still checked for changes.
+    --verify      With --incremental, read every directory anyway.
+    --timeout DURATION
+                  Stop scanning after DURATION (e.g. "90s", "1h30m"),
+                  and show the results so far, as with Ctrl-C.
+    --by KEY      Show the total size and number of files by KEY,
+                  rather than the biggest entries: "ext" for the file
+                  extension, "category" for the kind of content
+                  (video, images, archives, logs, ...), "owner" for
+                  the user, or "group" for the group owning the files,
+                  or "age" for a histogram of the time since the
+                  files were last modified.
+    --categories FILE
+                  Read the categories of extensions from FILE, one
+                  category per line, e.g. "video: mp4 mkv".
+    --user USER   Only count the entries owned by USER (a name, or
+                  a numeric ID).
+    --older-than AGE
+                  Also show how much of each entry was not modified
+                  within AGE (e.g. "180d", "12w", "1y").
+    --stale       With --older-than, only count the entries not
+                  modified within AGE, to find the most stale data.
+    --atime       Judge the age of entries by when they were last
+                  accessed, rather than modified.
+    --dupes       Show the sets of files with the same contents,
+                  which would free the most space if removed.
+    --min-size SIZE
+                  With --dupes, only compare files of at least SIZE
+                  (default: 1M).
+    --archives    List the contents of zip and tar archives (also
+                  .tar.gz and .tar.zst) as if they were directories,
+                  with their uncompressed sizes. Archives are shown
+                  as [a], and only count their own size in totals.
+    --reclaimable Show the entries which can usually be removed
+                  safely, as they are rebuilt or downloaded again on
+                  demand (node_modules, build outputs, caches), and
+                  how much space they take up. Nothing is removed.
+    --junk-rules FILE
+                  Read more rules for --reclaimable from FILE, one
+                  per line, e.g. "bazel: bazel-out".
+
+"dua check" compares the results to the limits in the file BUDGET,
+one per line, e.g. "build/** <= 2GB" or "logs <= 10000 files", and
+shows the biggest entries for every limit exceeded. In that case, or
+if a pattern matches nothing, dua exits with status 3.
+
+While scanning, the progress is shown on stderr if it is a terminal;
+otherwise, it is printed on receipt of SIGUSR1 (or SIGINFO).
+
+Entries which could not be read are summarized after the results.
+In that case, the totals are incomplete, and dua exits with status 2.
+The same applies when the scan is interrupted with Ctrl-C, or stopped
+by --timeout; entries whose totals are incomplete are marked with
+"(incomplete)".
 `)
 }
 
@@ -60,112 +205,65 @@ func fmtBytes[I ~int64 | uint64](i I) string {
 	}
 }
 
-type NodeStat struct {
-	path     string
-	type_    string
-	subtotal int64
-	total    int64
-	children []*NodeStat
-}
-
-func NewNodeStat(p string) *NodeStat {
-	return &NodeStat{
-		path:     p,
-		type_:    " ",
-		children: []*NodeStat{},
+// parseSize parses a size such as "4096", "512K", "1.5GB" or "2TiB";
+// as in fmtBytes, the units are powers of 1024.
+func parseSize(s string) (int64, error) {
+	n := strings.ToUpper(strings.TrimSpace(s))
+	n = strings.TrimSuffix(strings.TrimSuffix(n, "B"), "I")
+	unit := int64(1)
+	if i := strings.IndexAny(n, "KMGTP"); i >= 0 && i == len(n)-1 {
+		unit = map[byte]int64{'K': KB, 'M': MB, 'G': GB, 'T': TB, 'P': PB}[n[i]]
+		n = n[:i]
 	}
-}
-
-func (s *NodeStat) String() string {
-	return fmt.Sprintf("%s [%s] %s", fmtBytes(s.Total()), s.type_, s.path)
-}
-
-func (s *NodeStat) Walk() error {
-	f, err := os.Open(s.path)
-	if err != nil {
-		Eprintln(err.Error())
-		return err
-	}
-	dirEntries, err := f.ReadDir(-1)
-	if err != nil {
-		f.Close()
-		Eprintln(err.Error())
-		return err
-	}
-	f.Close()
-
-	for _, d := range dirEntries {
-		fpath := path.Join(s.path, d.Name())
-		child := NewNodeStat(fpath)
-		s.children = append(s.children, child)
-		if d.IsDir() {
-			child.type_ = "d"
-			if err := child.Walk(); err != nil {
-				continue
-			}
-		} else if d.Type().IsRegular() {
-			info, err := d.Info()
-			if err != nil {
-				Eprintln(err.Error())
-				return err
-			}
-			child.type_ = "f"
-			child.total = info.Size()
-		} else {
-			child.type_ = "?"
-		}
+	f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("invalid size %q (e.g. 4096, 512K, 1.5GB)", s)
 	}
-	return nil
+	return int64(f * float64(unit)), nil
 }
 
-func (s *NodeStat) Total() int64 {
-	if s.total == 0 {
-		s.total = s.subtotal
-		for _, child := range s.children {
-			s.total += child.Total()
-		}
+// format describes s in a single line of the results.
+func format(s *scan.NodeStat) string {
+	str := fmt.Sprintf("%s [%s] %s", fmtBytes(s.Total()), s.Type(), s.Path())
+	if showShared && s.Shared() > 0 {
+		str += fmt.Sprintf(" (%s shared)", strings.TrimSpace(fmtBytes(s.Shared())))
 	}
-	return s.total
-}
-
-func (s *NodeStat) Top(n uint) []*NodeStat {
-	s.Total()
-	top := []*NodeStat{}
-	includeSelf := true
-	for _, child := range s.children {
-		// if any single child takes up more than a % of the total,
-		// don't include self in the top stats (as self would compete
-		// with the child for the top spot)
-		if float64(child.Total()) > (float64(s.Total()) * threshold) {
-			includeSelf = false
-		}
-		// include up to n top candidates from each child, since we're
-		// not meant to return more than n anyway
-		top = append(top, child.Top(n)...)
-	}
-	if includeSelf {
-		top = append(top, s)
-	}
-	slices.SortFunc(top, func(a, b *NodeStat) int {
-		return int(b.total - a.total)
-	})
-	if n > 0 {
-		return top[:min(n, uint(len(top)))]
-	} else {
-		return top
+	if stale != nil {
+		str += fmt.Sprintf(" (%s stale)", strings.TrimSpace(fmtBytes(stale[s.Path()])))
+	}
+	if s.Incomplete() {
+		str += " (incomplete)"
 	}
+	return str
 }
 
 func main() {
+	ignoreStatusSignals()
+	argv := os.Args[1:]
+	if len(argv) > 0 && argv[0] == "check" {
+		checkMode = true
+		argv = argv[1:]
+	}
 	args, opts, err := getopt.GetOpt(
-		os.Args[1:],
-		"ht:n:",
-		nil,
+		argv,
+		"hit:n:j:PHLlx",
+		[]string{
+			"apparent-size", "count-links", "shared",
+			"exclude=", "exclude-from=", "exclude-summary",
+			"errors=", "format=", "tree-json",
+			"export=", "import=", "save=", "diff=",
+			"incremental=", "verify", "timeout=",
+			"by=", "categories=", "user=",
+			"older-than=", "stale", "atime",
+			"dupes", "min-size=", "archives",
+			"reclaimable", "junk-rules=",
+		},
 	)
 	if err != nil {
 		showUsage()
 		os.Exit(1)
 	}
+	var scanOpts scan.Options
 	for _, opt := range opts {
 		switch opt.Option {
 		// case "-v":
@@ -174,6 +272,8 @@ func main() {
 		case "-h":
 			showHelp()
 			os.Exit(0)
+		case "-i":
+			interactive = true
 		case "-t":
 			var err error
 			if threshold, err = strconv.ParseFloat(opt.Argument, 64); err != nil {
@@ -194,22 +294,344 @@ func main() {
 				Eprintln("N must be greater than 0.")
 				os.Exit(1)
 			}
+		case "-j":
+			var err error
+			if scanOpts.Jobs, err = strconv.Atoi(opt.Argument); err != nil {
+				Eprintln(err.Error())
+				os.Exit(1)
+			}
+			if scanOpts.Jobs <= 0 {
+				Eprintln("JOBS must be greater than 0.")
+				os.Exit(1)
+			}
+		case "-P":
+			scanOpts.Follow = scan.FollowNever
+		case "-H":
+			scanOpts.Follow = scan.FollowRoot
+		case "-L":
+			scanOpts.Follow = scan.FollowAll
+		case "--apparent-size":
+			scanOpts.ApparentSize = true
+		case "-l", "--count-links":
+			scanOpts.CountLinks = true
+		case "--shared":
+			showShared = true
+		case "-x":
+			scanOpts.OneFilesystem = true
+		case "--exclude":
+			scanOpts.Exclude = append(scanOpts.Exclude, opt.Argument)
+		case "--exclude-from":
+			patterns, err := scan.ReadPatterns(opt.Argument)
+			if err != nil {
+				Eprintln(err.Error())
+				os.Exit(1)
+			}
+			scanOpts.Exclude = append(scanOpts.Exclude, patterns...)
+		case "--exclude-summary":
+			excludeSummary = true
+		case "--errors":
+			errorsFile = opt.Argument
+		case "--format":
+			if opt.Argument != "text" && opt.Argument != "json" {
+				Eprintln("FORMAT must be one of: text, json.")
+				os.Exit(1)
+			}
+			outputFormat = opt.Argument
+		case "--tree-json":
+			treeJSON = true
+		case "--export":
+			exportFile = opt.Argument
+		case "--import":
+			importFile = opt.Argument
+		case "--save":
+			saveFile = opt.Argument
+		case "--diff":
+			diffFile = opt.Argument
+		case "--incremental":
+			incrementalFile = opt.Argument
+		case "--verify":
+			scanOpts.Verify = true
+		case "--timeout":
+			var err error
+			if timeout, err = time.ParseDuration(opt.Argument); err != nil {
+				Eprintln(err.Error())
+				os.Exit(1)
+			}
+			if timeout <= 0 {
+				Eprintln("DURATION must be greater than 0.")
+				os.Exit(1)
+			}
+		case "--by":
+			if !slices.Contains(groupKeys, opt.Argument) {
+				Eprintln("KEY must be one of: " + strings.Join(groupKeys, ", ") + ".")
+				os.Exit(1)
+			}
+			groupBy = opt.Argument
+		case "--categories":
+			var err error
+			if categories, err = scan.ReadCategories(opt.Argument); err != nil {
+				Eprintln(err.Error())
+				os.Exit(1)
+			}
+		case "--user":
+			onlyUser = opt.Argument
+		case "--older-than":
+			var err error
+			if staleAge, err = parseAge(opt.Argument); err != nil {
+				Eprintln(err.Error())
+				os.Exit(1)
+			}
+		case "--stale":
+			rankStale = true
+		case "--atime":
+			useAtime = true
+		case "--reclaimable":
+			reclaimable = true
+		case "--junk-rules":
+			rules, err := scan.ReadJunkRules(opt.Argument)
+			if err != nil {
+				Eprintln(err.Error())
+				os.Exit(1)
+			}
+			junkRules = append(slices.Clip(junkRules), rules...)
+		case "--archives":
+			scanOpts.Archives = true
+		case "--dupes":
+			findDupes = true
+		case "--min-size":
+			var err error
+			if dupesMinSize, err = parseSize(opt.Argument); err != nil {
+				Eprintln(err.Error())
+				os.Exit(1)
+			}
 		default:
 			panic("unexpected argument")
 		}
 	}
-	if len(args) != 1 {
+	var budgets []budget
+	if checkMode {
+		if len(args) == 0 {
+			showUsage()
+			os.Exit(1)
+		}
+		if budgets, err = readBudget(args[0]); err != nil {
+			Eprintln(err.Error())
+			os.Exit(1)
+		}
+		args = args[1:]
+	}
+	if importFile != "" && len(args) != 0 || importFile == "" && len(args) != 1 ||
+		rankStale && staleAge == 0 {
 		showUsage()
 		os.Exit(1)
 	}
 
-	root := NewNodeStat(args[0])
-	if err := root.Walk(); err != nil {
-		println(err.Error())
-		os.Exit(1)
+	var result *scan.Result
+	var exclude []string // the patterns result was scanned with
+	readonly := true
+	if importFile != "" {
+		result, err = importNcdu(importFile)
+		if err != nil {
+			Eprintln(err.Error())
+			os.Exit(1)
+		}
+		result.Root.SetApparentSize(scanOpts.ApparentSize)
+	} else if info, err := os.Stat(args[0]); err == nil && info.Mode().IsRegular() {
+		snap, err := loadSnapshot(args[0])
+		if err != nil {
+			Eprintln(err.Error())
+			os.Exit(1)
+		}
+		snap.Root.SetApparentSize(scanOpts.ApparentSize)
+		result = &scan.Result{Root: snap.Root}
+		exclude = snap.Exclude
+	} else {
+		if incrementalFile != "" {
+			if scanOpts.Previous, err = loadSnapshot(incrementalFile); err != nil {
+				Eprintln(err.Error())
+				os.Exit(1)
+			}
+		}
+		scanner, err := scan.NewScanner(scanOpts)
+		if err != nil {
+			Eprintln(err.Error())
+			os.Exit(1)
+		}
+		// Ctrl-C stops the scan, rather than dua, to show what was
+		// found so far.
+		ctx := context.Background()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
+		stop := showProgress(scanner)
+		result, err = scanner.ScanContext(ctx, args[0])
+		stop()
+		cancel()
+		if err != nil {
+			println(err.Error())
+			os.Exit(1)
+		}
+		readonly = false
+		exclude = scanOpts.Exclude
+	}
+	if saveFile != "" {
+		snap := &scan.Snapshot{Root: result.Root, Exclude: exclude}
+		if err := saveSnapshot(saveFile, snap); err != nil {
+			Eprintln(err.Error())
+			os.Exit(1)
+		}
+	}
+	if exportFile != "" {
+		if err := exportNcdu(exportFile, result.Root); err != nil {
+			Eprintln(err.Error())
+			os.Exit(1)
+		}
+	}
+	var keep func(*scan.NodeStat) bool
+	if onlyUser != "" {
+		uid, ok := userNames.lookup(onlyUser)
+		if !ok {
+			Eprintln("No such user: " + onlyUser)
+			os.Exit(1)
+		}
+		keep = func(s *scan.NodeStat) bool {
+			owner, _, ok := s.Owner()
+			return ok && owner == uid
+		}
+		result.Root = scan.Filter(result.Root, keep)
+		// Removing a directory would also remove the entries of
+		// other users, which are not shown.
+		readonly = true
+	}
+	if staleAge > 0 {
+		isStale := olderThan(time.Now().Add(-staleAge))
+		staleRoot := scan.Filter(result.Root, isStale)
+		if rankStale {
+			result.Root = staleRoot
+			readonly = true
+		}
+		stale = staleTotals(staleRoot)
+	}
+	if excludeSummary {
+		Eprintln(fmt.Sprintf(
+			"Excluded %s entries (%s in files)",
+			fmtCount(result.Excluded),
+			strings.TrimSpace(fmtBytes(result.ExcludedBytes)),
+		))
+	}
+	exceeded := 0
+	switch {
+	case checkMode:
+		if exceeded, err = checkBudgets(result.Root, budgets); err != nil {
+			Eprintln(err.Error())
+			os.Exit(1)
+		}
+	case diffFile != "":
+		snap, err := loadSnapshot(diffFile)
+		if err != nil {
+			Eprintln(err.Error())
+			os.Exit(1)
+		}
+		old := snap.Root
+		old.SetApparentSize(scanOpts.ApparentSize)
+		if keep != nil {
+			old = scan.Filter(old, keep)
+		}
+		printDiff(old, result.Root)
+	case findDupes:
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+		dupes, err := scan.FindDupes(ctx, result.Root, scan.DupeOptions{
+			MinSize: dupesMinSize,
+			Jobs:    scanOpts.Jobs,
+		})
+		cancel()
+		if err != nil {
+			Eprintln(err.Error())
+			os.Exit(1)
+		}
+		if outputFormat == "json" {
+			if err := writeDupesJSON(os.Stdout, dupes.Sets, result.Root, topn); err != nil {
+				Eprintln(err.Error())
+				os.Exit(1)
+			}
+		} else {
+			printDupes(dupes.Sets, topn)
+		}
+		result.Errors = append(result.Errors, dupes.Errors...)
+	case reclaimable:
+		junk, err := scan.FindJunk(result.Root, junkRules)
+		if err != nil {
+			Eprintln(err.Error())
+			os.Exit(1)
+		}
+		if outputFormat == "json" {
+			if err := writeJunkJSON(os.Stdout, junk, result.Root, topn); err != nil {
+				Eprintln(err.Error())
+				os.Exit(1)
+			}
+		} else {
+			printJunk(junk, topn)
+		}
+	case groupBy != "":
+		groups := scan.GroupBy(result.Root, groupKey(groupBy, categories))
+		if groupBy == "age" {
+			groups = ageHistogram(groups)
+		}
+		if outputFormat == "json" {
+			if err := writeGroupsJSON(os.Stdout, groups, result.Root, topn); err != nil {
+				Eprintln(err.Error())
+				os.Exit(1)
+			}
+		} else {
+			printGroups(groups, result.Root, topn)
+		}
+	case interactive:
+		if err := browse(result.Root, scanOpts.ApparentSize, readonly); err != nil {
+			Eprintln(err.Error())
+			os.Exit(1)
+		}
+	case treeJSON:
+		if err := writeTreeJSON(os.Stdout, result.Root); err != nil {
+			Eprintln(err.Error())
+			os.Exit(1)
+		}
+	case outputFormat == "json":
+		top := scan.Top(result.Root, topn, threshold)
+		if err := writeTopJSON(os.Stdout, result.Root, top); err != nil {
+			Eprintln(err.Error())
+			os.Exit(1)
+		}
+	default:
+		// println(fmtBytes(result.Root.Total()))
+		for _, s := range scan.Top(result.Root, topn, threshold) {
+			println(format(s))
+		}
+	}
+	status := 0
+	if errs := result.Errors; len(errs) > 0 {
+		Eprintln(summarizeErrors(errs))
+		if errorsFile != "" {
+			if err := writeErrors(errorsFile, errs); err != nil {
+				Eprintln(err.Error())
+			}
+		}
+		// Some entries were not counted.
+		status = 2
+	}
+	if unlisted := result.Unlisted; len(unlisted) > 0 {
+		// The archives are still counted as files.
+		Eprintln(summarizeUnlisted(unlisted))
+	}
+	if result.Cancelled {
+		Eprintln("Scan stopped early; totals marked (incomplete) are lower bounds.")
+		// Some directories were not read.
+		status = 2
 	}
-	// println(fmtBytes(root.Total()))
-	for _, s := range root.Top(uint(topn)) {
-		println(s.String())
+	if exceeded > 0 {
+		status = 3
 	}
+	os.Exit(status)
 }
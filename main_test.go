@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		want int64
+	}{
+		{"0", 0},
+		{"4096", 4096},
+		{"512K", 512 * KB},
+		{"512k", 512 * KB},
+		{"512KB", 512 * KB},
+		{"512KiB", 512 * KB},
+		{"1.5GB", 1.5 * GB},
+		{" 2 M ", 2 * MB},
+		{"3T", 3 * TB},
+		{"1P", PB},
+	} {
+		got, err := parseSize(tt.s)
+		if err != nil || got != tt.want {
+			t.Errorf("parseSize(%q) = %d, %v; want %d", tt.s, got, err, tt.want)
+		}
+	}
+	for _, s := range []string{"", "K", "-1", "1X", "1KK", "lots"} {
+		if got, err := parseSize(s); err == nil {
+			t.Errorf("parseSize(%q) = %d, want an error", s, got)
+		}
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		want time.Duration
+	}{
+		{"180d", 180 * day},
+		{"12w", 12 * week},
+		{"1y", year},
+		{"1.5d", 36 * time.Hour},
+		{"36h", 36 * time.Hour},
+	} {
+		got, err := parseAge(tt.s)
+		if err != nil || got != tt.want {
+			t.Errorf("parseAge(%q) = %v, %v; want %v", tt.s, got, err, tt.want)
+		}
+	}
+	for _, s := range []string{"", "0", "0d", "-1d", "-36h", "NaNd", "1e300y", "d", "1x"} {
+		if got, err := parseAge(s); err == nil {
+			t.Errorf("parseAge(%q) = %v, want an error", s, got)
+		}
+	}
+}
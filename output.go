@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rollcat/dua/scan"
+)
+
+// jsonVersion is the version of the JSON output schema, as described
+// in the readme. It changes whenever existing fields change meaning,
+// or are removed.
+const jsonVersion = 1
+
+// jsonNode describes a single entry in the JSON output.
+type jsonNode struct {
+	Path    string  `json:"path"`
+	Bytes   int64   `json:"bytes"`
+	Type    string  `json:"type"`
+	Files   int64   `json:"files"`
+	Percent float64 `json:"percent"`
+
+	Incomplete bool `json:"incomplete,omitempty"`
+
+	// With --older-than.
+	StaleBytes *int64 `json:"stale_bytes,omitempty"`
+
+	// With --reclaimable.
+	Junk string `json:"junk,omitempty"`
+}
+
+func newJSONNode(s, root *scan.NodeStat) jsonNode {
+	n := jsonNode{
+		Path:  s.Path(),
+		Bytes: s.Total(),
+		Type:  jsonType(s),
+		Files: s.Files(),
+
+		Incomplete: s.Incomplete(),
+		Junk:       s.Junk(),
+	}
+	if stale != nil {
+		bytes := stale[s.Path()]
+		n.StaleBytes = &bytes
+	}
+	if root.Total() > 0 {
+		n.Percent = 100 * float64(s.Total()) / float64(root.Total())
+	}
+	return n
+}
+
+// jsonType returns the type of s; unlike in the text output, the
+// root directory is reported as such.
+func jsonType(s *scan.NodeStat) string {
+	if s.Type() == " " {
+		return "d"
+	}
+	return s.Type()
+}
+
+// writeTopJSON writes the top entries under root to w.
+func writeTopJSON(w io.Writer, root *scan.NodeStat, top []*scan.NodeStat) error {
+	out := struct {
+		Version int        `json:"version"`
+		Root    jsonNode   `json:"root"`
+		Results []jsonNode `json:"results"`
+	}{
+		Version: jsonVersion,
+		Root:    newJSONNode(root, root),
+		Results: make([]jsonNode, 0, len(top)),
+	}
+	for _, s := range top {
+		out.Results = append(out.Results, newJSONNode(s, root))
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// writeTreeJSON writes the whole tree under root to w. The tree is
+// written one node at a time, rather than built in memory first, as
+// it can have millions of entries.
+func writeTreeJSON(w io.Writer, root *scan.NodeStat) error {
+	// bufio.Writer remembers the first error, reported by Flush.
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `{"version":%d,"tree":`, jsonVersion)
+	if err := writeNodeJSON(bw, root, root); err != nil {
+		return err
+	}
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
+
+func writeNodeJSON(w *bufio.Writer, s, root *scan.NodeStat) error {
+	b, err := json.Marshal(newJSONNode(s, root))
+	if err != nil {
+		return err
+	}
+	// Splice the children into the object, before its closing brace.
+	w.Write(b[:len(b)-1])
+	if children := s.Children(); len(children) > 0 {
+		w.WriteString(`,"children":[`)
+		for i, child := range children {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			if err := writeNodeJSON(w, child, root); err != nil {
+				return err
+			}
+		}
+		w.WriteByte(']')
+	}
+	w.WriteByte('}')
+	return nil
+}
+
+// exportNcdu writes the tree under root to the named file, in the
+// format of ncdu -o.
+func exportNcdu(name string, root *scan.NodeStat) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := scan.WriteNcdu(f, root); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// importNcdu reads a tree from the named file, as written by ncdu -o.
+func importNcdu(name string) (*scan.Result, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return scan.ReadNcdu(f)
+}
+
+// saveSnapshot saves snap to the named file.
+func saveSnapshot(name string, snap *scan.Snapshot) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := scan.WriteSnapshot(f, snap); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// loadSnapshot reads a snapshot saved with saveSnapshot.
+func loadSnapshot(name string) (*scan.Snapshot, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	snap, err := scan.ReadSnapshot(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return snap, nil
+}
+
+// printDiff prints the entries which grew and shrank the most between
+// the trees old and new.
+func printDiff(old, new *scan.NodeStat) {
+	println(fmt.Sprintf("Total: %s", fmtDelta(new.Total()-old.Total())))
+	for _, section := range []struct {
+		title string
+		diff  *scan.NodeStat
+		sign  int64
+	}{
+		{"Grown:", scan.Diff(old, new), 1},
+		{"Shrunk:", scan.Diff(new, old), -1},
+	} {
+		println(section.title)
+		for _, s := range scan.Top(section.diff, topn, threshold) {
+			if s.Total() <= 0 {
+				break
+			}
+			println(fmt.Sprintf("%s [%s] %s", fmtDelta(section.sign*s.Total()), s.Type(), s.Path()))
+		}
+	}
+}
+
+// fmtDelta formats a change in size, with its sign.
+func fmtDelta(i int64) string {
+	sign := "+"
+	if i < 0 {
+		sign, i = "-", -i
+	}
+	return sign + fmtBytes(i)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rollcat/dua/scan"
+)
+
+// idNames maps user or group IDs to their names, as listed in a file
+// in the format of /etc/passwd or /etc/group. IDs missing from the
+// file are shown as numbers.
+type idNames struct {
+	file  string
+	once  sync.Once
+	names map[uint32]string
+}
+
+var (
+	userNames  = &idNames{file: "/etc/passwd"}
+	groupNames = &idNames{file: "/etc/group"}
+)
+
+func (n *idNames) load() {
+	n.once.Do(func() {
+		n.names = map[uint32]string{}
+		f, err := os.Open(n.file)
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			// name:password:ID:...
+			fields := strings.Split(scanner.Text(), ":")
+			if len(fields) < 3 || strings.HasPrefix(fields[0], "#") {
+				continue
+			}
+			id, err := strconv.ParseUint(fields[2], 10, 32)
+			if err != nil {
+				continue
+			}
+			if _, ok := n.names[uint32(id)]; !ok {
+				n.names[uint32(id)] = fields[0]
+			}
+		}
+	})
+}
+
+// name returns the name of id.
+func (n *idNames) name(id uint32) string {
+	n.load()
+	if name, ok := n.names[id]; ok {
+		return name
+	}
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+// lookup returns the ID named name, which may also be a number.
+func (n *idNames) lookup(name string) (uint32, bool) {
+	if id, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return uint32(id), true
+	}
+	n.load()
+	for id, s := range n.names {
+		if s == name {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// ownerName returns the name of the user owning s.
+func ownerName(s *scan.NodeStat) string {
+	uid, _, ok := s.Owner()
+	if !ok {
+		return "(unknown)"
+	}
+	return userNames.name(uid)
+}
+
+// groupName returns the name of the group owning s.
+func groupName(s *scan.NodeStat) string {
+	_, gid, ok := s.Owner()
+	if !ok {
+		return "(unknown)"
+	}
+	return groupNames.name(gid)
+}
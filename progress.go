@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/rollcat/dua/scan"
+	"golang.org/x/term"
+)
+
+// showProgress reports the progress of scanner on stderr, until the
+// returned function is called: on a single, continuously updated line
+// if stderr is a terminal, and whenever one of statusSignals arrives.
+func showProgress(scanner *scan.Scanner) (stop func()) {
+	tty := term.IsTerminal(int(os.Stderr.Fd()))
+	sig := make(chan os.Signal, 1)
+	if len(statusSignals) > 0 {
+		signal.Notify(sig, statusSignals...)
+	}
+	var tick <-chan time.Time
+	var ticker *time.Ticker
+	if tty {
+		ticker = time.NewTicker(200 * time.Millisecond)
+		tick = ticker.C
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-tick:
+				width, _, err := term.GetSize(int(os.Stderr.Fd()))
+				if err != nil {
+					width = 80
+				}
+				line := progressLine(scanner.Progress())
+				if r := []rune(line); len(r) >= width {
+					line = string(r[:max(width-1, 0)])
+				}
+				fmt.Fprintf(os.Stderr, "\r%s\x1b[K", line)
+			case <-sig:
+				if tty {
+					fmt.Fprint(os.Stderr, "\r\x1b[K")
+				}
+				Eprintln(progressLine(scanner.Progress()))
+			case <-done:
+				if tty {
+					fmt.Fprint(os.Stderr, "\r\x1b[K")
+				}
+				return
+			}
+		}
+	}()
+	return func() {
+		ignoreStatusSignals()
+		if ticker != nil {
+			ticker.Stop()
+		}
+		close(done)
+		<-stopped
+	}
+}
+
+// ignoreStatusSignals ignores statusSignals outside of scans, rather
+// than letting them terminate dua, as they do by default.
+func ignoreStatusSignals() {
+	// Without any arguments, Ignore would ignore all signals.
+	if len(statusSignals) > 0 {
+		signal.Ignore(statusSignals...)
+	}
+}
+
+// progressLine describes p in a single line, e.g.:
+//
+//	Scanned 12,345 entries, 1.21 GB in 3.2s (3,858/s, 378.12 MB/s): /srv/db
+func progressLine(p scan.Progress) string {
+	elapsed := p.Elapsed.Truncate(100 * time.Millisecond)
+	line := fmt.Sprintf("Scanned %s entries, %s in %s",
+		fmtCount(p.Entries), strings.TrimSpace(fmtBytes(p.Bytes)), elapsed)
+	if secs := p.Elapsed.Seconds(); secs > 0 {
+		line += fmt.Sprintf(" (%s/s, %s/s)",
+			fmtCount(int64(float64(p.Entries)/secs)),
+			strings.TrimSpace(fmtBytes(int64(float64(p.Bytes)/secs))))
+	}
+	if p.Dir != "" {
+		line += ": " + p.Dir
+	}
+	return line
+}
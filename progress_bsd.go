@@ -0,0 +1,12 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// statusSignals ask for the progress of a scan; SIGINFO is sent by
+// pressing Ctrl-T in the terminal.
+var statusSignals = []os.Signal{syscall.SIGUSR1, syscall.SIGINFO}
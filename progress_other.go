@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// statusSignals ask for the progress of a scan; there are none here.
+var statusSignals []os.Signal
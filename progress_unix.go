@@ -0,0 +1,11 @@
+//go:build unix && !(darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// statusSignals ask for the progress of a scan.
+var statusSignals = []os.Signal{syscall.SIGUSR1}
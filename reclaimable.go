@@ -0,0 +1,71 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/rollcat/dua/scan"
+)
+
+// junkTotal returns the total size of the junk entries.
+func junkTotal(junk []*scan.NodeStat) int64 {
+	var total int64
+	for _, s := range junk {
+		total += s.Total()
+	}
+	return total
+}
+
+// printJunk prints the first n junk entries, the totals by rule, and
+// the space all of them take up.
+func printJunk(junk []*scan.NodeStat, n int) {
+	for _, s := range junk[:min(n, len(junk))] {
+		println(fmt.Sprintf("%s (%s)", format(s), s.Junk()))
+	}
+	var rules []string
+	totals := map[string]int64{}
+	for _, s := range junk {
+		if _, ok := totals[s.Junk()]; !ok {
+			rules = append(rules, s.Junk())
+		}
+		totals[s.Junk()] += s.Total()
+	}
+	// The entries are sorted by size, so the rules are mostly sorted
+	// already.
+	slices.SortStableFunc(rules, func(a, b string) int {
+		return cmp.Compare(totals[b], totals[a])
+	})
+	if len(rules) > 0 {
+		println("By rule:")
+	}
+	for _, rule := range rules {
+		println(fmt.Sprintf("%s  %s", fmtBytes(totals[rule]), rule))
+	}
+	println(fmt.Sprintf("You could free %s in %s entries.",
+		strings.TrimSpace(fmtBytes(junkTotal(junk))), fmtCount(len(junk))))
+}
+
+// writeJunkJSON writes the first n junk entries to w.
+func writeJunkJSON(w io.Writer, junk []*scan.NodeStat, root *scan.NodeStat, n int) error {
+	out := struct {
+		Version     int        `json:"version"`
+		Root        jsonNode   `json:"root"`
+		Junk        []jsonNode `json:"junk"`
+		Reclaimable int64      `json:"reclaimable"`
+	}{
+		Version:     jsonVersion,
+		Root:        newJSONNode(root, root),
+		Junk:        make([]jsonNode, 0, min(n, len(junk))),
+		Reclaimable: junkTotal(junk),
+	}
+	for _, s := range junk[:min(n, len(junk))] {
+		out.Junk = append(out.Junk, newJSONNode(s, root))
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
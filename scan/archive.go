@@ -0,0 +1,168 @@
+package scan
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// archiveFormats maps the extensions of supported archives, as
+// returned by Ext, to the functions listing their contents.
+var archiveFormats = map[string]func(f fs.File, size int64, add addFunc) error{
+	"zip":     readZip,
+	"jar":     readZip,
+	"tar":     readTar(nil),
+	"tar.gz":  readTar(gzipReader),
+	"tgz":     readTar(gzipReader),
+	"tar.zst": readTar(zstdReader),
+}
+
+// addFunc records an entry of an archive, given its name within the
+// archive and its type.
+type addFunc func(name, type_ string, size int64, mtime time.Time)
+
+// isArchive reports whether s is a file in a supported archive format.
+func isArchive(s *NodeStat) bool {
+	_, ok := archiveFormats[Ext(s)]
+	return ok
+}
+
+// archive reads the contents of the archive s, whose name within fsys
+// is name, and adds them as its children; s then has the type "a". If
+// the archive cannot be read, s is left as a regular file.
+func (w *walker) archive(s *NodeStat, name string) error {
+	f, err := w.fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Archives need not list the directories before their entries;
+	// node returns the entry at p within the archive, creating it (as
+	// a directory) and its parents as needed.
+	nodes := map[string]*NodeStat{".": s}
+	var node func(p string) *NodeStat
+	node = func(p string) *NodeStat {
+		if n := nodes[p]; n != nil {
+			return n
+		}
+		parent := node(path.Dir(p))
+		n := newNodeStat(path.Join(s.path, p))
+		n.type_ = "d"
+		n.parent = parent
+		parent.children = append(parent.children, n)
+		nodes[p] = n
+		return n
+	}
+	add := func(name, type_ string, size int64, mtime time.Time) {
+		// Keep entries named "../x" or "/x" inside the archive.
+		p := strings.TrimPrefix(path.Clean("/"+name), "/")
+		if p == "" {
+			return
+		}
+		// Later entries of a tar replace earlier ones.
+		n := node(p)
+		n.type_ = type_
+		n.size, n.usage = size, size
+		n.mtime = mtime.UnixNano()
+		n.atime = n.mtime
+	}
+	if err := archiveFormats[Ext(s)](f, s.size, add); err != nil {
+		s.children = []*NodeStat{}
+		return err
+	}
+	for _, n := range nodes {
+		slices.SortFunc(n.children, func(a, b *NodeStat) int {
+			return strings.Compare(a.path, b.path)
+		})
+	}
+	s.type_ = "a"
+	return nil
+}
+
+func readZip(f fs.File, size int64, add addFunc) error {
+	ra, ok := f.(io.ReaderAt)
+	if !ok {
+		return errors.New("zip archive not seekable")
+	}
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return err
+	}
+	for _, zf := range zr.File {
+		mode := zf.Mode()
+		switch {
+		case mode.IsDir():
+			add(zf.Name, "d", 0, zf.Modified)
+		case mode.IsRegular():
+			add(zf.Name, "f", int64(zf.UncompressedSize64), zf.Modified)
+		case mode&fs.ModeSymlink != 0:
+			add(zf.Name, "l", int64(zf.UncompressedSize64), zf.Modified)
+		default:
+			add(zf.Name, "?", int64(zf.UncompressedSize64), zf.Modified)
+		}
+	}
+	return nil
+}
+
+// readTar returns a function listing the contents of a tar archive,
+// compressed as undone by decompress (if set).
+func readTar(decompress func(io.Reader) (io.ReadCloser, error)) func(fs.File, int64, addFunc) error {
+	return func(f fs.File, size int64, add addFunc) error {
+		var r io.Reader = f
+		if decompress != nil {
+			dr, err := decompress(f)
+			if err != nil {
+				return err
+			}
+			defer dr.Close()
+			r = dr
+		}
+		tr := tar.NewReader(r)
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			switch h.Typeflag {
+			case tar.TypeDir:
+				add(h.Name, "d", 0, h.ModTime)
+			case tar.TypeReg, tar.TypeRegA, tar.TypeGNUSparse:
+				add(h.Name, "f", h.Size, h.ModTime)
+			case tar.TypeSymlink:
+				add(h.Name, "l", int64(len(h.Linkname)), h.ModTime)
+			case tar.TypeLink:
+				// Hard links take up no space of their own.
+				add(h.Name, "f", 0, h.ModTime)
+			case tar.TypeXHeader, tar.TypeXGlobalHeader, tar.TypeGNULongName, tar.TypeGNULongLink:
+				// Handled by tar.Reader.
+			default:
+				add(h.Name, "?", h.Size, h.ModTime)
+			}
+		}
+	}
+}
+
+func gzipReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+func zstdReader(r io.Reader) (io.ReadCloser, error) {
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return zr.IOReadCloser(), nil
+}
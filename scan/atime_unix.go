@@ -0,0 +1,9 @@
+//go:build unix && !(darwin || freebsd || netbsd || aix)
+
+package scan
+
+import "syscall"
+
+func atime(st *syscall.Stat_t) int64 {
+	return st.Atim.Nano()
+}
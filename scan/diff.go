@@ -0,0 +1,100 @@
+package scan
+
+import (
+	"path"
+	"slices"
+	"strings"
+)
+
+// Diff returns a tree of the differences between two scans of the
+// same directory, old and new. Every node in the result has the size
+// of the corresponding node in new, less its size in old; entries
+// missing in either tree count as empty. The paths are those of new.
+//
+// The entries which grew the most are then given by Top(Diff(old,
+// new), ...), and those which shrank the most by Top(Diff(new, old),
+// ...), considering only the results with a positive Total.
+func Diff(old, new *NodeStat) *NodeStat {
+	d := diff(old, new, new.path, nil)
+	d.SetApparentSize(new.apparent)
+	return d
+}
+
+// diff compares old and new, either of which may be nil.
+func diff(old, new *NodeStat, p string, parent *NodeStat) *NodeStat {
+	d := newNodeStat(p)
+	d.parent = parent
+	var oldChildren, newChildren []*NodeStat
+	if old != nil {
+		d.type_ = old.type_
+		d.size -= old.countedSize()
+		d.usage -= old.countedUsage()
+		oldChildren = old.children
+	}
+	if new != nil {
+		d.type_ = new.type_
+		d.size += new.countedSize()
+		d.usage += new.countedUsage()
+		newChildren = new.children
+	}
+	// Sort the children by name, so they can be matched up by
+	// merging the two lists.
+	oldChildren = sortedByName(oldChildren)
+	newChildren = sortedByName(newChildren)
+	for len(oldChildren) > 0 || len(newChildren) > 0 {
+		var o, n *NodeStat
+		switch {
+		case len(newChildren) == 0:
+			o, oldChildren = oldChildren[0], oldChildren[1:]
+		case len(oldChildren) == 0:
+			n, newChildren = newChildren[0], newChildren[1:]
+		default:
+			on, nn := path.Base(oldChildren[0].path), path.Base(newChildren[0].path)
+			switch {
+			case on < nn:
+				o, oldChildren = oldChildren[0], oldChildren[1:]
+			case on > nn:
+				n, newChildren = newChildren[0], newChildren[1:]
+			default:
+				o, oldChildren = oldChildren[0], oldChildren[1:]
+				n, newChildren = newChildren[0], newChildren[1:]
+			}
+		}
+		name := path.Base(pick(n, o).path)
+		d.children = append(d.children, diff(o, n, path.Join(p, name), d))
+	}
+	return d
+}
+
+// countedSize and countedUsage return the size of s itself, as
+// counted in the totals.
+func (s *NodeStat) countedSize() int64 {
+	if s.linked {
+		return 0
+	}
+	return s.size
+}
+
+func (s *NodeStat) countedUsage() int64 {
+	if s.linked {
+		return 0
+	}
+	return s.usage
+}
+
+// sortedByName returns a copy of nodes, sorted by base name. Scanned
+// trees are sorted already, but imported ones may not be.
+func sortedByName(nodes []*NodeStat) []*NodeStat {
+	nodes = slices.Clone(nodes)
+	slices.SortFunc(nodes, func(a, b *NodeStat) int {
+		return strings.Compare(path.Base(a.path), path.Base(b.path))
+	})
+	return nodes
+}
+
+func pick(a, b *NodeStat) *NodeStat {
+	if a != nil {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,80 @@
+package scan
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+// totals maps the path of every entry under s to its Total.
+func totals(s *NodeStat) map[string]int64 {
+	m := map[string]int64{}
+	var walk func(s *NodeStat)
+	walk = func(s *NodeStat) {
+		m[s.path] = s.Total()
+		for _, child := range s.children {
+			walk(child)
+		}
+	}
+	walk(s)
+	return m
+}
+
+func scanMapFS(t *testing.T, fsys fstest.MapFS) *NodeStat {
+	t.Helper()
+	sc, err := NewScanner(Options{ApparentSize: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := sc.ScanFS(fsys, "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result.Root
+}
+
+func TestDiffTotals(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		old := scanMapFS(t, randomFS(r, r.Intn(40)))
+		new := scanMapFS(t, randomFS(r, r.Intn(40)))
+		oldTotals, newTotals := totals(old), totals(new)
+		for p, total := range totals(Diff(old, new)) {
+			if want := newTotals[p] - oldTotals[p]; total != want {
+				t.Fatalf("tree %d: %s changed by %d, want %d", i, p, total, want)
+			}
+		}
+	}
+}
+
+func TestDiffTop(t *testing.T) {
+	old := scanMapFS(t, fstest.MapFS{
+		"root/a/f":     {Data: make([]byte, 10)},
+		"root/b/g":     {Data: make([]byte, 5)},
+		"root/b/other": {Data: make([]byte, 1)},
+	})
+	new := scanMapFS(t, fstest.MapFS{
+		"root/a/f":     {Data: make([]byte, 30)},
+		"root/b/other": {Data: make([]byte, 1)},
+		"root/c/h":     {Data: make([]byte, 7)},
+	})
+	for _, tt := range []struct {
+		name     string
+		old, new *NodeStat
+		want     []string
+	}{
+		{"grown", old, new, []string{"root/a/f=20", "root/c/h=7"}},
+		{"shrunk", new, old, []string{"root/b/g=5"}},
+	} {
+		var got []string
+		for _, s := range Top(Diff(tt.old, tt.new), 10, 0.9) {
+			if s.Total() > 0 {
+				got = append(got, paths([]*NodeStat{s})...)
+			}
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package scan
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// partialSize is the number of bytes hashed from the start of a file,
+// to tell apart most files of the same size without reading them.
+const partialSize = 16 << 10
+
+// DupeOptions configure FindDupes. The zero value is ready to use.
+type DupeOptions struct {
+	// MinSize is the smallest (apparent) size of files to compare;
+	// empty files are never compared.
+	MinSize int64
+
+	// Jobs is the number of files to read in parallel. If 0,
+	// DefaultJobs is used.
+	Jobs int
+
+	// FS is the filesystem to read the files from, for trees from
+	// ScanFS. If nil, the files are read from the local filesystem.
+	FS fs.FS
+}
+
+// A DupeSet is a set of files with the same contents.
+type DupeSet struct {
+	// Files are sorted by path; hard links to the same file are only
+	// listed once.
+	Files []*NodeStat
+}
+
+// Size returns the size of each of the files.
+func (d DupeSet) Size() int64 {
+	return d.Files[0].Size()
+}
+
+// Reclaimable returns the space freed by keeping only one of the
+// files.
+func (d DupeSet) Reclaimable() int64 {
+	return d.Size() * int64(len(d.Files)-1)
+}
+
+// Dupes holds the outcome of FindDupes.
+type Dupes struct {
+	// Sets are sorted by the reclaimable space, biggest first.
+	Sets []DupeSet
+
+	// Errors lists files which could not be read, sorted by path.
+	Errors []*fs.PathError
+}
+
+// FindDupes finds the regular files under root with the same contents.
+// Files are only read if they have the same size as another file; and
+// fully only if they also start with the same bytes. The returned
+// error is only set if ctx is done before finishing.
+func FindDupes(ctx context.Context, root *NodeStat, opts DupeOptions) (*Dupes, error) {
+	if opts.Jobs <= 0 {
+		opts.Jobs = DefaultJobs
+	}
+	f := &dupeFinder{ctx: ctx, opts: opts}
+
+	// Group the files by size, counting hard links once.
+	seen := map[fileID]bool{}
+	bySize := map[int64][]*NodeStat{}
+	var walk func(s *NodeStat)
+	walk = func(s *NodeStat) {
+		if s.type_ == "f" || s.type_ == "a" {
+			if s.size > 0 && s.size >= opts.MinSize && (s.id == (fileID{}) || !seen[s.id]) {
+				seen[s.id] = true
+				bySize[s.size] = append(bySize[s.size], s)
+			}
+			// The contents of archives cannot be read as files.
+			return
+		}
+		for _, child := range s.children {
+			walk(child)
+		}
+	}
+	walk(root)
+
+	var candidates [][]*NodeStat
+	for _, files := range bySize {
+		if len(files) > 1 {
+			candidates = append(candidates, files)
+		}
+	}
+	candidates = f.refine(candidates, true)
+	candidates = f.refine(candidates, false)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	dupes := &Dupes{Errors: f.errs}
+	for _, files := range candidates {
+		slices.SortFunc(files, func(a, b *NodeStat) int {
+			return strings.Compare(a.path, b.path)
+		})
+		dupes.Sets = append(dupes.Sets, DupeSet{Files: files})
+	}
+	slices.SortFunc(dupes.Sets, func(a, b DupeSet) int {
+		if c := cmp.Compare(b.Reclaimable(), a.Reclaimable()); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Files[0].path, b.Files[0].path)
+	})
+	slices.SortFunc(dupes.Errors, func(a, b *fs.PathError) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return dupes, nil
+}
+
+// dupeFinder holds the state of FindDupes.
+type dupeFinder struct {
+	ctx  context.Context
+	opts DupeOptions
+
+	mu   sync.Mutex
+	errs []*fs.PathError
+}
+
+// refine splits every group of files by the hash of their first bytes
+// (if partial is set), or of their whole contents, dropping the files
+// which turn out to be unique. Files which could not be read are
+// recorded, and also dropped.
+func (f *dupeFinder) refine(groups [][]*NodeStat, partial bool) [][]*NodeStat {
+	var files []*NodeStat
+	for _, group := range groups {
+		// Files no bigger than the partial hash are already known to
+		// be the same.
+		if partial || group[0].size > partialSize {
+			files = append(files, group...)
+		}
+	}
+	hashes := f.hashAll(files, partial)
+
+	var refined [][]*NodeStat
+	for _, group := range groups {
+		if !partial && group[0].size <= partialSize {
+			refined = append(refined, group)
+			continue
+		}
+		byHash := map[string][]*NodeStat{}
+		var keys []string
+		for _, s := range group {
+			h, ok := hashes[s]
+			if !ok {
+				continue
+			}
+			if byHash[h] == nil {
+				keys = append(keys, h)
+			}
+			byHash[h] = append(byHash[h], s)
+		}
+		for _, h := range keys {
+			if len(byHash[h]) > 1 {
+				refined = append(refined, byHash[h])
+			}
+		}
+	}
+	return refined
+}
+
+// hashAll hashes files in parallel, and returns the hashes of those
+// which could be read.
+func (f *dupeFinder) hashAll(files []*NodeStat, partial bool) map[*NodeStat]string {
+	hashes := make(map[*NodeStat]string, len(files))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	next := make(chan *NodeStat)
+	for i := 0; i < min(f.opts.Jobs, len(files)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range next {
+				h, err := f.hash(s, partial)
+				if err != nil {
+					f.fail(s, err)
+					continue
+				}
+				mu.Lock()
+				hashes[s] = h
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, s := range files {
+		if f.ctx.Err() != nil {
+			break
+		}
+		next <- s
+	}
+	close(next)
+	wg.Wait()
+	return hashes
+}
+
+// fail records an error encountered while reading s.
+func (f *dupeFinder) fail(s *NodeStat, err error) {
+	perr := &fs.PathError{Op: "read", Path: s.path, Err: err}
+	var e *fs.PathError
+	if errors.As(err, &e) {
+		perr.Op, perr.Err = e.Op, e.Err
+	}
+	f.mu.Lock()
+	f.errs = append(f.errs, perr)
+	f.mu.Unlock()
+}
+
+// hash returns the SHA-256 hash of the contents of s; or only of its
+// first partialSize bytes, if partial is set.
+func (f *dupeFinder) hash(s *NodeStat, partial bool) (string, error) {
+	var r io.ReadCloser
+	var err error
+	if f.opts.FS != nil {
+		r, err = f.opts.FS.Open(s.path)
+	} else {
+		r, err = os.Open(s.path)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	var src io.Reader = r
+	if partial {
+		src = io.LimitReader(r, partialSize)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, &ctxReader{f.ctx, src}); err != nil {
+		return "", err
+	}
+	return string(h.Sum(nil)), nil
+}
+
+// ctxReader stops reading once ctx is done, so that hashing a big
+// file can be cancelled.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
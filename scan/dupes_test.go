@@ -0,0 +1,145 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+// dupePaths returns the paths of the files in each set of dupes.
+func dupePaths(dupes *Dupes) [][]string {
+	var sets [][]string
+	for _, set := range dupes.Sets {
+		var paths []string
+		for _, s := range set.Files {
+			paths = append(paths, s.Path())
+		}
+		sets = append(sets, paths)
+	}
+	return sets
+}
+
+func TestFindDupes(t *testing.T) {
+	big := bytes.Repeat([]byte("x"), 2*partialSize)
+	// Same start, different end: only told apart by the full hash.
+	bigEnd := slices.Clone(big)
+	bigEnd[len(bigEnd)-1] = 'y'
+	// Same size, different start: told apart by the partial hash.
+	bigStart := slices.Clone(big)
+	bigStart[0] = 'y'
+	fsys := fstest.MapFS{
+		"root/big1":       {Data: big},
+		"root/sub/big2":   {Data: big},
+		"root/big3":       {Data: big},
+		"root/bigEnd":     {Data: bigEnd},
+		"root/bigStart":   {Data: bigStart},
+		"root/small1":     {Data: []byte("small")},
+		"root/sub/small2": {Data: []byte("small")},
+		"root/other":      {Data: []byte("other")},
+		"root/empty1":     {},
+		"root/empty2":     {},
+	}
+	sc, err := NewScanner(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := sc.ScanFS(fsys, "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		minSize int64
+		want    [][]string
+	}{
+		{0, [][]string{
+			{"root/big1", "root/big3", "root/sub/big2"},
+			{"root/small1", "root/sub/small2"},
+		}},
+		{6, [][]string{
+			{"root/big1", "root/big3", "root/sub/big2"},
+		}},
+		{int64(len(big)) + 1, nil},
+	} {
+		for _, jobs := range []int{1, 4} {
+			dupes, err := FindDupes(context.Background(), result.Root, DupeOptions{
+				MinSize: tt.minSize,
+				Jobs:    jobs,
+				FS:      fsys,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(dupes.Errors) > 0 {
+				t.Errorf("errors: %v", dupes.Errors)
+			}
+			got := dupePaths(dupes)
+			if !slices.EqualFunc(got, tt.want, slices.Equal[[]string]) {
+				t.Errorf("MinSize %d, Jobs %d: got %q, want %q", tt.minSize, jobs, got, tt.want)
+			}
+			if len(dupes.Sets) > 0 {
+				if got, want := dupes.Sets[0].Reclaimable(), 2*int64(len(big)); got != want {
+					t.Errorf("MinSize %d: reclaimable %d, want %d", tt.minSize, got, want)
+				}
+			}
+		}
+	}
+
+	// Files which disappeared since the scan are reported, and left out.
+	delete(fsys, "root/big3")
+	dupes, err := FindDupes(context.Background(), result.Root, DupeOptions{FS: fsys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dupes.Errors) != 1 || dupes.Errors[0].Path != "root/big3" {
+		t.Errorf("got errors %v, want one for root/big3", dupes.Errors)
+	}
+	if got := dupePaths(dupes); len(got) == 0 || !slices.Equal(got[0], []string{"root/big1", "root/sub/big2"}) {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestFindDupesHardLinks(t *testing.T) {
+	root := t.TempDir()
+	data := []byte("the same contents")
+	for _, name := range []string{"a", "copy"} {
+		if err := os.WriteFile(filepath.Join(root, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Hard links take no extra space, so they are not duplicates.
+	for _, name := range []string{"link1", "link2"} {
+		if err := os.Link(filepath.Join(root, "a"), filepath.Join(root, name)); err != nil {
+			t.Skip(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "single"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(root, "single"), filepath.Join(root, "single-link")); err != nil {
+		t.Fatal(err)
+	}
+	sc, err := NewScanner(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := sc.Scan(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dupes, err := FindDupes(context.Background(), result.Root, DupeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{
+		filepath.Join(root, "a"),
+		filepath.Join(root, "copy"),
+		filepath.Join(root, "single"),
+	}}
+	if got := dupePaths(dupes); !slices.EqualFunc(got, want, slices.Equal[[]string]) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,149 @@
+package scan
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+// pattern is a glob pattern split into path segments. Each segment
+// is matched using path.Match, except for "**", which matches any
+// number of segments (including none); a trailing "**" matches
+// everything inside a directory, but not the directory itself.
+type pattern []string
+
+// compilePattern parses a glob pattern. Patterns containing a slash
+// are matched against the whole path relative to the scan root;
+// patterns without one match an entry of that name at any depth. A
+// leading "/" or "./" is optional.
+func compilePattern(s string) (pattern, error) {
+	s = strings.TrimSuffix(s, "/")
+	var p pattern
+	if !strings.Contains(s, "/") {
+		p = append(p, "**")
+	}
+	s = strings.TrimPrefix(s, "./")
+	s = strings.TrimPrefix(s, "/")
+	for _, seg := range strings.Split(s, "/") {
+		if _, err := path.Match(seg, ""); err != nil {
+			return nil, err
+		}
+		p = append(p, seg)
+	}
+	return p, nil
+}
+
+// match reports whether the relative, slash-separated path matches p.
+func (p pattern) match(rel string) bool {
+	return matchSegments(p, strings.Split(rel, "/"))
+}
+
+func matchSegments(p pattern, segs []string) bool {
+	for len(p) > 0 {
+		if p[0] == "**" {
+			if len(p) == 1 {
+				return len(segs) > 0
+			}
+			for i := 0; i <= len(segs); i++ {
+				if matchSegments(p[1:], segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(p[0], segs[0]); !ok {
+			return false
+		}
+		p, segs = p[1:], segs[1:]
+	}
+	return len(segs) == 0
+}
+
+// patterns is a list of compiled exclude patterns.
+type patterns []pattern
+
+func compilePatterns(ss []string) (patterns, error) {
+	ps := make(patterns, 0, len(ss))
+	for _, s := range ss {
+		p, err := compilePattern(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", err, s)
+		}
+		ps = append(ps, p)
+	}
+	return ps, nil
+}
+
+// match reports whether the relative path matches any of the
+// patterns.
+func (ps patterns) match(rel string) bool {
+	for _, p := range ps {
+		if p.match(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// samePatterns reports whether a and b hold the same patterns, in
+// any order.
+func samePatterns(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(slices.Compact(a), slices.Compact(b))
+}
+
+// ReadPatterns reads glob patterns from a file, one per line. Blank
+// lines and lines starting with "#" are ignored.
+func ReadPatterns(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var ss []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ss = append(ss, line)
+	}
+	return ss, scanner.Err()
+}
+
+// Match returns the entries under root (or root itself, for the
+// pattern ".") whose paths relative to root match the glob pattern,
+// as in Options.Exclude. Entries inside other matching entries are
+// left out, so that their totals can be added up.
+func Match(root *NodeStat, pattern string) ([]*NodeStat, error) {
+	if pattern == "." || pattern == "/" {
+		return []*NodeStat{root}, nil
+	}
+	p, err := compilePattern(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", err, pattern)
+	}
+	var matches []*NodeStat
+	var walk func(s *NodeStat, rel string)
+	walk = func(s *NodeStat, rel string) {
+		for _, child := range s.children {
+			childRel := path.Join(rel, path.Base(child.path))
+			if p.match(childRel) {
+				matches = append(matches, child)
+			} else {
+				walk(child, childRel)
+			}
+		}
+	}
+	walk(root, ".")
+	return matches, nil
+}
@@ -0,0 +1,136 @@
+package scan
+
+import (
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+func TestPatternMatch(t *testing.T) {
+	for _, tt := range []struct {
+		pattern string
+		matches []string
+		misses  []string
+	}{
+		{
+			pattern: "node_modules",
+			matches: []string{"node_modules", "a/node_modules", "a/b/node_modules"},
+			misses:  []string{"node_modules/x", "node_modules2", "a/node_modules/x"},
+		},
+		{
+			pattern: "*.log",
+			matches: []string{"x.log", "a/b/x.log"},
+			misses:  []string{"x.log/y", "xlog"},
+		},
+		{
+			pattern: "/build",
+			matches: []string{"build"},
+			misses:  []string{"a/build", "build/x"},
+		},
+		{
+			pattern: "./build",
+			matches: []string{"build"},
+			misses:  []string{"a/build", "build/x"},
+		},
+		{
+			pattern: "build/",
+			matches: []string{"build", "a/build"},
+			misses:  []string{"build/x"},
+		},
+		{
+			pattern: "a/b",
+			matches: []string{"a/b"},
+			misses:  []string{"x/a/b", "a/b/c", "a"},
+		},
+		{
+			pattern: "a/**",
+			matches: []string{"a/b", "a/b/c"},
+			misses:  []string{"a", "b/a/c"},
+		},
+		{
+			pattern: "**/x/**",
+			matches: []string{"x/y", "a/x/y", "a/b/x/y/z"},
+			misses:  []string{"x", "a/x", "a/xx/y"},
+		},
+		{
+			pattern: "**/.git/objects",
+			matches: []string{".git/objects", "a/.git/objects"},
+			misses:  []string{".git", "a/.git/objects/x", "git/objects"},
+		},
+		{
+			pattern: "a/**/z",
+			matches: []string{"a/z", "a/b/z", "a/b/c/z"},
+			misses:  []string{"z", "a", "a/z/b"},
+		},
+	} {
+		p, err := compilePattern(tt.pattern)
+		if err != nil {
+			t.Errorf("compilePattern(%q): %v", tt.pattern, err)
+			continue
+		}
+		for _, rel := range tt.matches {
+			if !p.match(rel) {
+				t.Errorf("%q does not match %q", tt.pattern, rel)
+			}
+		}
+		for _, rel := range tt.misses {
+			if p.match(rel) {
+				t.Errorf("%q matches %q", tt.pattern, rel)
+			}
+		}
+	}
+}
+
+func TestPatternInvalid(t *testing.T) {
+	for _, pattern := range []string{"[", "a/[b", "**/x[/y"} {
+		if _, err := compilePattern(pattern); err == nil {
+			t.Errorf("compilePattern(%q) succeeded", pattern)
+		}
+		if _, err := NewScanner(Options{Exclude: []string{pattern}}); err == nil {
+			t.Errorf("NewScanner with Exclude %q succeeded", pattern)
+		}
+		if _, err := Match(newNodeStat("root"), pattern); err == nil {
+			t.Errorf("Match(%q) succeeded", pattern)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	fsys := fstest.MapFS{
+		"root/build/x/y": {Data: []byte("1")},
+		"root/build/z":   {Data: []byte("1")},
+		"root/a/build/w": {Data: []byte("1")},
+		"root/a/keep":    {Data: []byte("1")},
+	}
+	sc, err := NewScanner(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := sc.ScanFS(fsys, "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		pattern string
+		want    []string
+	}{
+		{".", []string{"root"}},
+		{"build", []string{"root/a/build", "root/build"}},
+		{"/build", []string{"root/build"}},
+		{"build/**", []string{"root/build/x", "root/build/z"}},
+		{"**/w", []string{"root/a/build/w"}},
+		{"nothing", nil},
+	} {
+		matches, err := Match(result.Root, tt.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, s := range matches {
+			got = append(got, s.Path())
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Match(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
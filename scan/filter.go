@@ -0,0 +1,42 @@
+package scan
+
+// Filter returns a copy of the tree under s, with only the entries
+// for which keep returns true, and the directories leading to them.
+// Directories kept only for their contents do not count their own
+// size. The totals of the copy, and so Top, then only cover the kept
+// entries; e.g. the files owned by a single user.
+func Filter(s *NodeStat, keep func(*NodeStat) bool) *NodeStat {
+	c := filter(s, nil, keep)
+	if c == nil {
+		c = filterCopy(s, nil)
+		c.size, c.usage = 0, 0
+	}
+	return c
+}
+
+// filter returns the copy of s, or nil if neither s nor any of its
+// descendants are kept.
+func filter(s, parent *NodeStat, keep func(*NodeStat) bool) *NodeStat {
+	c := filterCopy(s, parent)
+	for _, child := range s.children {
+		if cc := filter(child, c, keep); cc != nil {
+			c.children = append(c.children, cc)
+		}
+	}
+	if keep(s) {
+		return c
+	}
+	if len(c.children) == 0 {
+		return nil
+	}
+	c.size, c.usage = 0, 0
+	return c
+}
+
+func filterCopy(s, parent *NodeStat) *NodeStat {
+	c := *s
+	c.parent = parent
+	c.children = []*NodeStat{}
+	c.summed = false
+	return &c
+}
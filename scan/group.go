@@ -0,0 +1,127 @@
+package scan
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+// A Group holds the totals of the files sharing the same key, as
+// returned by GroupBy.
+type Group struct {
+	Key   string
+	Bytes int64 // apparent or allocated, as chosen by SetApparentSize
+	Files int64
+}
+
+// GroupBy adds up the regular files under s by key, and returns the
+// groups, biggest first. Hard-linked files are only counted at the
+// first path they were found under, as in Total.
+func GroupBy(s *NodeStat, key func(*NodeStat) string) []Group {
+	groups := map[string]*Group{}
+	var walk func(s *NodeStat)
+	walk = func(s *NodeStat) {
+		if s.type_ == "f" || s.type_ == "a" {
+			if s.linked {
+				return
+			}
+			k := key(s)
+			g := groups[k]
+			if g == nil {
+				g = &Group{Key: k}
+				groups[k] = g
+			}
+			g.Bytes += s.Size()
+			g.Files++
+			// As in Total, archives only count as themselves.
+			return
+		}
+		for _, child := range s.children {
+			walk(child)
+		}
+	}
+	walk(s)
+	result := make([]Group, 0, len(groups))
+	for _, g := range groups {
+		result = append(result, *g)
+	}
+	slices.SortFunc(result, func(a, b Group) int {
+		if c := cmp.Compare(b.Bytes, a.Bytes); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Key, b.Key)
+	})
+	return result
+}
+
+// Ext returns the extension of the name of s, in lower case and
+// without the leading dot, or "" if it has none. Compressed tarballs
+// keep both extensions, e.g. "tar.gz".
+func Ext(s *NodeStat) string {
+	name := strings.ToLower(path.Base(s.path))
+	// The name of a hidden file is not an extension.
+	ext := path.Ext(strings.TrimLeft(name, "."))
+	if ext == "" {
+		return ""
+	}
+	if base := strings.TrimSuffix(name, ext); path.Ext(base) == ".tar" {
+		ext = ".tar" + ext
+	}
+	return ext[1:]
+}
+
+// DefaultCategories maps file extensions, as returned by Ext, to
+// broad categories of content.
+var DefaultCategories = map[string]string{}
+
+func init() {
+	for category, exts := range map[string]string{
+		"video":     "mp4 m4v mkv avi mov wmv flv webm mpg mpeg ts vob",
+		"audio":     "mp3 flac wav ogg opus m4a aac wma aiff",
+		"images":    "jpg jpeg png gif bmp tif tiff webp heic raw cr2 nef dng psd svg ico",
+		"documents": "pdf doc docx xls xlsx ppt pptx odt ods odp txt md rtf epub",
+		"archives":  "zip tar tar.gz tgz tar.bz2 tar.xz tar.zst gz bz2 xz zst 7z rar",
+		"logs":      "log",
+		"vm images": "iso img qcow2 vmdk vdi vhd vhdx ova",
+		"databases": "db sqlite sqlite3 mdb ibd",
+		"build artifacts": "o a so dylib dll exe lib obj class jar pyc pyo " +
+			"whl rlib rmeta wasm",
+	} {
+		for _, ext := range strings.Fields(exts) {
+			DefaultCategories[ext] = category
+		}
+	}
+}
+
+// ReadCategories reads a mapping of file extensions to categories
+// from a file, one category per line: its name, a colon, and a list
+// of extensions, e.g. "video: mp4 mkv". Blank lines and lines
+// starting with "#" are ignored.
+func ReadCategories(name string) (map[string]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	categories := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		category, exts, ok := strings.Cut(line, ":")
+		category = strings.TrimSpace(category)
+		if !ok || category == "" {
+			return nil, fmt.Errorf("%s:%d: expected CATEGORY: EXTENSIONS", name, n)
+		}
+		for _, ext := range strings.Fields(exts) {
+			categories[strings.ToLower(strings.TrimPrefix(ext, "."))] = category
+		}
+	}
+	return categories, scanner.Err()
+}
@@ -0,0 +1,138 @@
+package scan
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+// A JunkRule describes entries which can usually be removed without
+// losing anything, as they are rebuilt or downloaded again on demand:
+// dependencies, build outputs, and caches.
+type JunkRule struct {
+	// Name describes the rule, e.g. "node_modules".
+	Name string
+
+	// Pattern matches the entries, as in Options.Exclude.
+	Pattern string
+
+	// If set, only entries next to another entry of this name match,
+	// e.g. "target" only next to "Cargo.toml".
+	If string
+}
+
+// DefaultJunkRules are the rules FindJunk is usually given.
+var DefaultJunkRules = []JunkRule{
+	{Name: "node_modules", Pattern: "node_modules", If: "package.json"},
+	{Name: "rust target", Pattern: "target", If: "Cargo.toml"},
+	{Name: "maven target", Pattern: "target", If: "pom.xml"},
+	{Name: "gradle", Pattern: ".gradle"},
+	{Name: "gradle build", Pattern: "build", If: "build.gradle"},
+	{Name: "gradle build", Pattern: "build", If: "build.gradle.kts"},
+	{Name: "python cache", Pattern: "__pycache__"},
+	{Name: "python cache", Pattern: ".pytest_cache"},
+	{Name: "python cache", Pattern: ".mypy_cache"},
+	{Name: "python cache", Pattern: ".ruff_cache"},
+	{Name: "tox", Pattern: ".tox"},
+	{Name: "terraform", Pattern: ".terraform"},
+	{Name: "next.js cache", Pattern: "**/.next/cache"},
+	{Name: "parcel cache", Pattern: ".parcel-cache"},
+	{Name: "user cache", Pattern: ".cache"},
+	{Name: "docker build cache", Pattern: "**/docker/buildkit"},
+}
+
+// ReadJunkRules reads rules from a file, one per line: the name of
+// the rule, a colon, the pattern, and optionally "if" and the name of
+// another entry which must be next to the matching ones, e.g.:
+//
+//	rust target: target if Cargo.toml
+//
+// Blank lines and lines starting with "#" are ignored.
+func ReadJunkRules(name string) ([]JunkRule, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var rules []JunkRule
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ruleName, rest, _ := strings.Cut(line, ":")
+		fields := strings.Fields(rest)
+		rule := JunkRule{Name: strings.TrimSpace(ruleName)}
+		switch {
+		case len(fields) == 1:
+			rule.Pattern = fields[0]
+		case len(fields) == 3 && fields[1] == "if":
+			rule.Pattern, rule.If = fields[0], fields[2]
+		default:
+			return nil, fmt.Errorf("%s:%d: expected NAME: PATTERN [if NAME]", name, n)
+		}
+		if rule.Name == "" {
+			return nil, fmt.Errorf("%s:%d: expected NAME: PATTERN [if NAME]", name, n)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// Junk returns the name of the JunkRule matching s, as tagged by
+// FindJunk, or "".
+func (s *NodeStat) Junk() string {
+	return s.junk
+}
+
+// FindJunk tags the entries under root matching any of the rules (see
+// Junk), and returns them, biggest first. Entries inside those which
+// match are not considered, and neither is root itself. Nothing is
+// removed.
+func FindJunk(root *NodeStat, rules []JunkRule) ([]*NodeStat, error) {
+	compiled := make([]pattern, len(rules))
+	for i, rule := range rules {
+		p, err := compilePattern(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", err, rule.Pattern)
+		}
+		compiled[i] = p
+	}
+	var junk []*NodeStat
+	var walk func(s *NodeStat, rel string)
+	walk = func(s *NodeStat, rel string) {
+		for _, child := range s.children {
+			childRel := path.Join(rel, path.Base(child.path))
+			child.junk = ""
+			for i, rule := range rules {
+				if compiled[i].match(childRel) && (rule.If == "" || s.has(rule.If)) {
+					child.junk = rule.Name
+					break
+				}
+			}
+			switch {
+			case child.junk != "":
+				junk = append(junk, child)
+			case child.type_ == "d":
+				walk(child, childRel)
+			}
+		}
+	}
+	walk(root, ".")
+	slices.SortStableFunc(junk, func(a, b *NodeStat) int {
+		return cmp.Compare(b.Total(), a.Total())
+	})
+	return junk, nil
+}
+
+// has reports whether the directory s has an entry named name.
+func (s *NodeStat) has(name string) bool {
+	return slices.ContainsFunc(s.children, func(c *NodeStat) bool {
+		return path.Base(c.path) == name
+	})
+}
@@ -0,0 +1,299 @@
+package scan
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// The ncdu export format is described at:
+// https://dev.yorhel.nl/ncdu/jsonfmt
+
+const (
+	ncduMajor = 1
+	ncduMinor = 2
+)
+
+// ErrNcduUnreadable is reported for entries which ncdu could not
+// read when creating the export.
+var ErrNcduUnreadable = errors.New("unreadable in ncdu export")
+
+// ncduInfo describes a single entry in an ncdu export.
+type ncduInfo struct {
+	Name     string `json:"name"`
+	Asize    int64  `json:"asize,omitempty"`
+	Dsize    int64  `json:"dsize,omitempty"`
+	Dev      uint64 `json:"dev,omitempty"`
+	Ino      uint64 `json:"ino,omitempty"`
+	Hlnkc    bool   `json:"hlnkc,omitempty"`
+	Nlink    uint64 `json:"nlink,omitempty"`
+	ReadErr  bool   `json:"read_error,omitempty"`
+	Excluded string `json:"excluded,omitempty"`
+	Notreg   bool   `json:"notreg,omitempty"`
+
+	// Only in extended exports (ncdu -e).
+	Uid   *uint32 `json:"uid,omitempty"`
+	Gid   *uint32 `json:"gid,omitempty"`
+	Mtime int64   `json:"mtime,omitempty"` // in Unix seconds
+}
+
+// WriteNcdu writes the tree under root to w, in the format of ncdu's
+// -o option, so that it can be browsed with ncdu -f.
+func WriteNcdu(w io.Writer, root *NodeStat) error {
+	// bufio.Writer remembers the first error, reported by Flush.
+	bw := bufio.NewWriter(w)
+	meta, err := json.Marshal(map[string]any{
+		"progname":  "dua",
+		"timestamp": time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(bw, "[%d,%d,%s,\n", ncduMajor, ncduMinor, meta)
+	if err := writeNcdu(bw, root, 0); err != nil {
+		return err
+	}
+	bw.WriteString("]\n")
+	return bw.Flush()
+}
+
+func writeNcdu(w *bufio.Writer, s *NodeStat, dev uint64) error {
+	info := ncduInfo{
+		Name:  path.Base(s.path),
+		Asize: s.size,
+		Dsize: s.usage,
+		Ino:   s.id.ino,
+		// Directories which could not be read, or were left unread
+		// by a cancelled scan.
+		ReadErr: s.incomplete,
+	}
+	if s.parent == nil {
+		info.Name = s.path
+	}
+	if s.owner.known {
+		info.Uid, info.Gid = &s.owner.uid, &s.owner.gid
+	}
+	if s.mtime > 0 {
+		info.Mtime = s.mtime / 1e9
+	}
+	// The device is only given where it differs from the parent.
+	if s.id.dev != dev {
+		info.Dev = s.id.dev
+	}
+	if s.nlink > 1 {
+		info.Hlnkc = true
+		info.Nlink = s.nlink
+	}
+	switch s.type_ {
+	case "f", "d", " ", "a":
+	case "m":
+		info.Excluded = "otherfs"
+	default:
+		info.Notreg = true
+	}
+	b, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	if s.type_ != "d" && s.type_ != " " {
+		w.Write(b)
+		return nil
+	}
+	w.WriteByte('[')
+	w.Write(b)
+	for _, child := range s.children {
+		w.WriteString(",\n")
+		if err := writeNcdu(w, child, s.id.dev); err != nil {
+			return err
+		}
+	}
+	w.WriteByte(']')
+	return nil
+}
+
+// ReadNcdu reads a tree exported with ncdu -o (or WriteNcdu). Entries
+// which ncdu could not read are listed in the Result's Errors, and
+// entries it excluded by pattern are left out of the tree. Hard links
+// are only counted once, as in a Scan.
+func ReadNcdu(r io.Reader) (*Result, error) {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	if err := expectDelim(dec, '['); err != nil {
+		return nil, err
+	}
+	var major, minor int
+	if err := dec.Decode(&major); err != nil {
+		return nil, err
+	}
+	if err := dec.Decode(&minor); err != nil {
+		return nil, err
+	}
+	if major != ncduMajor {
+		return nil, fmt.Errorf("unsupported ncdu export version: %d.%d", major, minor)
+	}
+	var meta json.RawMessage
+	if err := dec.Decode(&meta); err != nil {
+		return nil, err
+	}
+	if err := expectDelim(dec, '['); err != nil {
+		return nil, err
+	}
+	result := &Result{}
+	root, err := readNcduDir(dec, nil, result)
+	if err != nil {
+		return nil, err
+	}
+	root.type_ = " "
+	root.dedup(map[fileID]bool{}, false)
+	result.Root = root
+	return result, nil
+}
+
+// readNcduDir reads a directory, after its opening bracket.
+func readNcduDir(dec *json.Decoder, parent *NodeStat, result *Result) (*NodeStat, error) {
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, err
+	}
+	s, err := readNcduInfo(dec, parent, result)
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		return nil, errors.New("excluded directory with entries in ncdu export")
+	}
+	s.type_ = "d"
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var child *NodeStat
+		switch t {
+		case json.Delim('['):
+			child, err = readNcduDir(dec, s, result)
+		case json.Delim('{'):
+			child, err = readNcduInfo(dec, s, result)
+		default:
+			err = fmt.Errorf("unexpected %v in ncdu export", t)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if child != nil {
+			s.children = append(s.children, child)
+		}
+	}
+	// ncdu lists the entries in the order it read them.
+	slices.SortFunc(s.children, func(a, b *NodeStat) int {
+		return strings.Compare(path.Base(a.path), path.Base(b.path))
+	})
+	return s, expectDelim(dec, ']')
+}
+
+// readNcduInfo reads the object describing a single entry, after its
+// opening brace. Entries excluded by pattern are returned as nil.
+func readNcduInfo(dec *json.Decoder, parent *NodeStat, result *Result) (*NodeStat, error) {
+	var info ncduInfo
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := t.(string)
+		var v any
+		switch key {
+		case "name":
+			v = &info.Name
+		case "asize":
+			v = &info.Asize
+		case "dsize":
+			v = &info.Dsize
+		case "dev":
+			v = &info.Dev
+		case "ino":
+			v = &info.Ino
+		case "hlnkc":
+			v = &info.Hlnkc
+		case "nlink":
+			v = &info.Nlink
+		case "read_error":
+			v = &info.ReadErr
+		case "excluded":
+			v = &info.Excluded
+		case "notreg":
+			v = &info.Notreg
+		case "uid":
+			v = &info.Uid
+		case "gid":
+			v = &info.Gid
+		case "mtime":
+			v = &info.Mtime
+		default:
+			v = &json.RawMessage{}
+		}
+		if err := dec.Decode(v); err != nil {
+			return nil, err
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return nil, err
+	}
+
+	s := newNodeStat(info.Name)
+	s.type_ = "f"
+	s.size = info.Asize
+	s.usage = info.Dsize
+	s.id = fileID{info.Dev, info.Ino}
+	s.nlink = info.Nlink
+	s.incomplete = info.ReadErr
+	// The export has no access times.
+	s.mtime = info.Mtime * 1e9
+	s.atime = s.mtime
+	if info.Uid != nil && info.Gid != nil {
+		s.owner = fileOwner{uid: *info.Uid, gid: *info.Gid, known: true}
+	}
+	if parent != nil {
+		s.path = path.Join(parent.path, info.Name)
+		s.parent = parent
+		if info.Dev == 0 {
+			s.id.dev = parent.id.dev
+		}
+	}
+	if info.Hlnkc {
+		s.nlink = max(s.nlink, 2)
+	}
+	if info.ReadErr {
+		result.Errors = append(result.Errors, &fs.PathError{
+			Op: "import", Path: s.path, Err: ErrNcduUnreadable,
+		})
+	}
+	switch {
+	case info.Excluded == "pattern":
+		result.Excluded++
+		result.ExcludedBytes += info.Asize
+		return nil, nil
+	case info.Excluded != "":
+		// Another filesystem, or a kernel filesystem.
+		s.type_ = "m"
+	case info.Notreg:
+		s.type_ = "?"
+	}
+	return s, nil
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if t != delim {
+		return fmt.Errorf("expected %v in ncdu export, got %v", delim, t)
+	}
+	return nil
+}
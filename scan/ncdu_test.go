@@ -0,0 +1,79 @@
+package scan
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// shape describes the entries of the tree under s which an ncdu
+// export keeps, one per line.
+func shape(s *NodeStat) []string {
+	var lines []string
+	var walk func(s *NodeStat)
+	walk = func(s *NodeStat) {
+		lines = append(lines, fmt.Sprintf("%s [%s] size=%d usage=%d linked=%v total=%d files=%d",
+			s.path, s.type_, s.size, s.usage, s.linked, s.Total(), s.Files()))
+		for _, child := range s.children {
+			walk(child)
+		}
+	}
+	walk(s)
+	return lines
+}
+
+func TestNcduRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		fsys := randomFS(r, r.Intn(40))
+		sc, err := NewScanner(Options{ApparentSize: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := sc.ScanFS(fsys, "root")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := WriteNcdu(&buf, result.Root); err != nil {
+			t.Fatal(err)
+		}
+		imported, err := ReadNcdu(&buf)
+		if err != nil {
+			t.Fatalf("tree %d: %v", i, err)
+		}
+		imported.Root.SetApparentSize(true)
+		want, got := shape(result.Root), shape(imported.Root)
+		if !slices.Equal(got, want) {
+			t.Errorf("tree %d:\ngot  %q\nwant %q", i, got, want)
+		}
+	}
+}
+
+func TestNcduSortsChildren(t *testing.T) {
+	export := `[1,2,{"progname":"ncdu"},
+[{"name":"/r"},
+{"name":"c","asize":3},
+[{"name":"a"},{"name":"z","asize":1},{"name":"b","asize":2}],
+{"name":"b","asize":4}]]`
+	result, err := ReadNcdu(strings.NewReader(export))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	var walk func(s *NodeStat)
+	walk = func(s *NodeStat) {
+		got = append(got, s.Path())
+		for _, child := range s.Children() {
+			walk(child)
+		}
+	}
+	walk(result.Root)
+	want := []string{"/r", "/r/a", "/r/a/b", "/r/a/z", "/r/b", "/r/c"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,383 @@
+package scan
+
+import (
+	"container/heap"
+	"slices"
+	"time"
+)
+
+// NodeStat describes a single entry in the scanned tree, and holds
+// the totals of the subtree rooted at it.
+type NodeStat struct {
+	path       string
+	type_      string
+	size       int64 // apparent size
+	usage      int64 // allocated size
+	mtime      int64 // modification time, in Unix nanoseconds
+	atime      int64 // access time, in Unix nanoseconds
+	apparent   bool  // report apparent rather than allocated sizes
+	incomplete bool  // the directory could not be read (completely)
+	followed   bool  // reached through a symbolic link; see Followed
+	summed     bool
+	partial    bool // s or any of its descendants is incomplete
+	totalSize  int64
+	totalUsage int64
+	files      int64
+	parent     *NodeStat
+	children   []*NodeStat
+
+	// Hard link bookkeeping; see dedup.
+	id          fileID
+	nlink       uint64
+	linked      bool
+	sharedSize  int64
+	sharedUsage int64
+
+	owner fileOwner
+	junk  string // see FindJunk
+}
+
+// fileID uniquely identifies a file within the system.
+type fileID struct {
+	dev, ino uint64
+}
+
+// fileOwner holds the user and group IDs owning a file, if known.
+type fileOwner struct {
+	uid, gid uint32
+	known    bool
+}
+
+func newNodeStat(p string) *NodeStat {
+	return &NodeStat{
+		path:     p,
+		type_:    " ",
+		children: []*NodeStat{},
+	}
+}
+
+// Path returns the path of the entry, starting with the path given
+// to Scan.
+func (s *NodeStat) Path() string {
+	return s.path
+}
+
+// Type returns a single character describing the kind of entry:
+//
+//	d  directory
+//	f  regular file
+//	l  symbolic link
+//	m  mount point of another filesystem (not scanned)
+//	a  archive, listing its contents as children (see Options.Archives)
+//	?  anything else
+//
+// The root of the scan has the type " ", unless it is a link.
+func (s *NodeStat) Type() string {
+	return s.type_
+}
+
+// Size returns the size of the entry itself, not including any of
+// its children.
+func (s *NodeStat) Size() int64 {
+	if s.apparent {
+		return s.size
+	}
+	return s.usage
+}
+
+// ModTime returns the time the entry was last modified.
+func (s *NodeStat) ModTime() time.Time {
+	return time.Unix(0, s.mtime)
+}
+
+// Owner returns the IDs of the user and group owning the entry. If
+// they are not known, e.g. on platforms without them, ok is false.
+func (s *NodeStat) Owner() (uid, gid uint32, ok bool) {
+	return s.owner.uid, s.owner.gid, s.owner.known
+}
+
+// AccessTime returns the time the entry was last accessed. Many
+// systems only update it once a day, or not at all (see the noatime
+// and relatime mount options).
+func (s *NodeStat) AccessTime() time.Time {
+	return time.Unix(0, s.atime)
+}
+
+// Followed reports whether s was reached by following a symbolic
+// link (see FollowAll). Its path is then that of the link, rather
+// than of the entry itself.
+func (s *NodeStat) Followed() bool {
+	return s.followed
+}
+
+// Parent returns the directory containing s, or nil for the root.
+func (s *NodeStat) Parent() *NodeStat {
+	return s.parent
+}
+
+// Children returns the entries of a directory, sorted by name.
+func (s *NodeStat) Children() []*NodeStat {
+	return s.children
+}
+
+// Dev returns the device ID of the filesystem containing the entry,
+// or 0 if it is not known.
+func (s *NodeStat) Dev() uint64 {
+	return s.id.dev
+}
+
+// Remove detaches s from its parent, e.g. after it was deleted from
+// disk, and updates the totals of all of its ancestors. Hard-linked
+// files counted under s are then counted at their next remaining
+// link, as dedup would have done without s.
+func (s *NodeStat) Remove() {
+	if s.parent == nil {
+		return
+	}
+	root := s.parent
+	for root.parent != nil {
+		root = root.parent
+	}
+	s.parent.children = slices.DeleteFunc(s.parent.children, func(c *NodeStat) bool {
+		return c == s
+	})
+	s.parent.unsum()
+	s.parent = nil
+
+	counted := map[fileID]bool{}
+	s.counted(counted)
+	if len(counted) > 0 {
+		root.relink(counted)
+	}
+}
+
+// counted adds the IDs of the entries under s which were counted in
+// the totals, rather than linked, to ids.
+func (s *NodeStat) counted(ids map[fileID]bool) {
+	if !s.linked && s.id != (fileID{}) {
+		ids[s.id] = true
+	}
+	for _, child := range s.children {
+		child.counted(ids)
+	}
+}
+
+// relink counts the first linked entry under s with each of ids,
+// in depth-first order, as its file is no longer counted elsewhere.
+func (s *NodeStat) relink(ids map[fileID]bool) {
+	if s.linked && ids[s.id] {
+		s.linked = false
+		delete(ids, s.id)
+		s.unsum()
+	}
+	for _, child := range s.children {
+		if len(ids) == 0 {
+			return
+		}
+		child.relink(ids)
+	}
+}
+
+// unsum forgets the totals of s and all of its ancestors.
+func (s *NodeStat) unsum() {
+	for p := s; p != nil; p = p.parent {
+		p.summed = false
+	}
+}
+
+// SetApparentSize chooses whether Size, Total and Shared report the
+// apparent or the allocated sizes, for s and all of its descendants.
+func (s *NodeStat) SetApparentSize(apparent bool) {
+	s.apparent = apparent
+	for _, child := range s.children {
+		child.SetApparentSize(apparent)
+	}
+}
+
+// Incomplete reports whether s, or any directory under it, could not
+// be read completely, e.g. because the scan was cancelled. If so, its
+// totals are lower bounds.
+func (s *NodeStat) Incomplete() bool {
+	s.sum()
+	return s.partial
+}
+
+// Shared returns the size of hard-linked files under s, which were
+// not counted in Total because they were already counted elsewhere.
+func (s *NodeStat) Shared() int64 {
+	s.sum()
+	if s.apparent {
+		return s.sharedSize
+	}
+	return s.sharedUsage
+}
+
+// Total returns the size of s and all of its descendants, either
+// apparent or allocated, depending on SetApparentSize.
+func (s *NodeStat) Total() int64 {
+	if s.apparent {
+		return s.ApparentTotal()
+	}
+	return s.AllocatedTotal()
+}
+
+// Files returns the number of regular files in s and all of its
+// descendants. Hard-linked files count once, as in Total.
+func (s *NodeStat) Files() int64 {
+	s.sum()
+	return s.files
+}
+
+// ApparentTotal returns the sum of apparent sizes of s and all of its
+// descendants.
+func (s *NodeStat) ApparentTotal() int64 {
+	s.sum()
+	return s.totalSize
+}
+
+// AllocatedTotal returns the sum of allocated sizes of s and all of
+// its descendants.
+func (s *NodeStat) AllocatedTotal() int64 {
+	s.sum()
+	return s.totalUsage
+}
+
+func (s *NodeStat) sum() {
+	if s.summed {
+		return
+	}
+	s.totalSize, s.totalUsage, s.files = 0, 0, 0
+	s.sharedSize, s.sharedUsage = 0, 0
+	s.partial = s.incomplete
+	if s.linked {
+		s.sharedSize, s.sharedUsage = s.size, s.usage
+	} else {
+		s.totalSize, s.totalUsage = s.size, s.usage
+	}
+	// Like their size, hard-linked files only count once.
+	if (s.type_ == "f" || s.type_ == "a") && !s.linked {
+		s.files = 1
+	}
+	for _, child := range s.children {
+		child.sum()
+		if s.type_ == "a" {
+			// The contents of an archive take up no space of their
+			// own, beyond that of the archive.
+			continue
+		}
+		s.files += child.files
+		s.totalSize += child.totalSize
+		s.totalUsage += child.totalUsage
+		s.sharedSize += child.sharedSize
+		s.sharedUsage += child.sharedUsage
+		s.partial = s.partial || child.partial
+	}
+	s.summed = true
+}
+
+// dedup marks all but the first path of every hard-linked file as
+// linked, so that its size only counts once. This runs after the
+// walk has finished, in depth-first order, to pick the same first
+// path regardless of the order in which directories were scanned.
+// With all set, every file is considered, not only those with
+// several links, as is needed when following symbolic links.
+func (s *NodeStat) dedup(seen map[fileID]bool, all bool) {
+	// Entries inside archives have no inode.
+	isFile := s.type_ == "f" || s.type_ == "a"
+	if (s.nlink > 1 || all && isFile) && s.id != (fileID{}) {
+		if seen[s.id] {
+			s.linked = true
+		}
+		seen[s.id] = true
+	}
+	for _, child := range s.children {
+		child.dedup(seen, all)
+	}
+}
+
+// loops reports whether s is the same directory as one of its
+// parents.
+func (s *NodeStat) loops() bool {
+	for p := s.parent; p != nil; p = p.parent {
+		if p.id == s.id {
+			return true
+		}
+	}
+	return false
+}
+
+// total returns Total, without summing the subtree first; sum must
+// have been called already.
+func (s *NodeStat) total() int64 {
+	if s.apparent {
+		return s.totalSize
+	}
+	return s.totalUsage
+}
+
+// Top returns up to n entries under s (including s itself), which
+// take up the most space, biggest first; entries of the same size are
+// ordered by path. If n is 0, all candidates are returned.
+//
+// A directory is only a candidate if none of its children takes up
+// more than the threshold (a fraction between 0.0 and 1.0) of its
+// total; otherwise, that child is a better answer.
+func Top(s *NodeStat, n int, threshold float64) []*NodeStat {
+	// Sum up the whole tree once, rather than lazily while walking.
+	s.sum()
+	// Keep the best n candidates found so far, with the worst of them
+	// at the root of the heap, so it can be replaced.
+	h := &topHeap{}
+	var walk func(s *NodeStat)
+	walk = func(s *NodeStat) {
+		includeSelf := true
+		for _, child := range s.children {
+			// if any single child takes up more than a % of the total,
+			// don't include self in the top stats (as self would compete
+			// with the child for the top spot)
+			if float64(child.total()) > (float64(s.total()) * threshold) {
+				includeSelf = false
+			}
+			walk(child)
+		}
+		switch {
+		case !includeSelf:
+		case n <= 0 || h.Len() < n:
+			heap.Push(h, s)
+		case ranksBefore(s, (*h)[0]):
+			(*h)[0] = s
+			heap.Fix(h, 0)
+		}
+	}
+	walk(s)
+	top := make([]*NodeStat, h.Len())
+	for i := len(top) - 1; i >= 0; i-- {
+		top[i] = heap.Pop(h).(*NodeStat)
+	}
+	return top
+}
+
+// ranksBefore reports whether a comes before b in the results of Top:
+// bigger first, and then by path.
+func ranksBefore(a, b *NodeStat) bool {
+	if a.total() != b.total() {
+		return a.total() > b.total()
+	}
+	return a.path < b.path
+}
+
+// topHeap is a heap of candidates for Top, with the one ranked last
+// at the root.
+type topHeap []*NodeStat
+
+func (h topHeap) Len() int           { return len(h) }
+func (h topHeap) Less(i, j int) bool { return ranksBefore(h[j], h[i]) }
+func (h topHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *topHeap) Push(x any)        { *h = append(*h, x.(*NodeStat)) }
+
+func (h *topHeap) Pop() any {
+	old := *h
+	s := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return s
+}
@@ -0,0 +1,596 @@
+// Package scan walks directory trees to find the files and
+// directories taking up the most space.
+//
+// A Scanner builds a tree of NodeStat from a directory on disk, or
+// any other fs.FS; Top then picks the biggest entries from that tree:
+//
+//	scanner, err := scan.NewScanner(scan.Options{})
+//	if err != nil {
+//		return err
+//	}
+//	result, err := scanner.Scan("/var")
+//	if err != nil {
+//		return err
+//	}
+//	for _, s := range scan.Top(result.Root, 20, 0.9) {
+//		fmt.Println(s.Total(), s.Path())
+//	}
+package scan
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultJobs is the number of directories read in parallel, unless
+// set in Options.
+var DefaultJobs = 2 * runtime.NumCPU()
+
+// ErrLoop is reported for directories which contain themselves,
+// e.g. through a symbolic link to one of their parents.
+var ErrLoop = errors.New("filesystem loop detected")
+
+// FollowMode tells which symbolic links to follow.
+type FollowMode int
+
+const (
+	FollowNever FollowMode = iota // like find -P
+	FollowRoot                    // like find -H
+	FollowAll                     // like find -L
+)
+
+// Options configure a Scanner. The zero value is ready to use.
+type Options struct {
+	// Jobs is the number of directories to read in parallel. If 0,
+	// DefaultJobs is used. The result does not depend on Jobs.
+	Jobs int
+
+	// ApparentSize reports apparent file sizes, rather than the
+	// space actually allocated on disk.
+	ApparentSize bool
+
+	// CountLinks counts hard-linked files once for every link,
+	// rather than only at the first path they were found under.
+	CountLinks bool
+
+	// OneFilesystem stays on the filesystem of the scanned
+	// directory; mount points of other filesystems are not scanned.
+	OneFilesystem bool
+
+	// Follow tells which symbolic links to follow.
+	Follow FollowMode
+
+	// Exclude lists glob patterns of entries to skip. Patterns
+	// without a slash match the name at any depth; other patterns
+	// match the path relative to the scanned directory, where "**"
+	// stands for any number of directories.
+	Exclude []string
+
+	// Previous is an earlier scan of the same directory, e.g. as read
+	// with ReadSnapshot. Directories which have the same
+	// inode and modification time as in Previous are not read again;
+	// instead, their entries are taken from Previous. Files are still
+	// checked for changes in size, and subdirectories for changes of
+	// their own entries. If Previous was scanned with other Exclude
+	// patterns, every directory is read again, as with Verify.
+	Previous *Snapshot
+
+	// Verify reads every directory, even if it has not changed since
+	// Previous.
+	Verify bool
+
+	// Archives lists the contents of zip and tar archives (also
+	// compressed with gzip or zstd) as their children, with their
+	// uncompressed sizes. The archives themselves have the type "a".
+	// Files which cannot be read as archives are left as regular
+	// files, and reported in Result.Unlisted.
+	Archives bool
+}
+
+// Scanner walks directory trees according to its Options.
+type Scanner struct {
+	opts     Options
+	excludes patterns
+
+	// Counters of the scan in progress, for Progress.
+	started atomic.Int64 // in Unix nanoseconds
+	entries atomic.Int64
+	bytes   atomic.Int64
+	dir     atomic.Pointer[string]
+}
+
+// NewScanner returns a Scanner, or an error if any of the options
+// are invalid.
+func NewScanner(opts Options) (*Scanner, error) {
+	excludes, err := compilePatterns(opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Jobs <= 0 {
+		opts.Jobs = DefaultJobs
+	}
+	return &Scanner{opts: opts, excludes: excludes}, nil
+}
+
+// Progress describes how far a scan has got.
+type Progress struct {
+	// Entries is the number of entries found so far, and Bytes their
+	// size (apparent or allocated, as in Options), counting hard
+	// links every time they were found.
+	Entries int64
+	Bytes   int64
+
+	// Dir is the directory which started being read most recently;
+	// if the scan seems stuck, most likely on this directory.
+	Dir string
+
+	// Elapsed is the time since the scan started.
+	Elapsed time.Duration
+}
+
+// Progress reports how far the current (or the last) Scan or ScanFS
+// has got. It is safe to call from any goroutine.
+func (sc *Scanner) Progress() Progress {
+	p := Progress{
+		Entries: sc.entries.Load(),
+		Bytes:   sc.bytes.Load(),
+	}
+	if dir := sc.dir.Load(); dir != nil {
+		p.Dir = *dir
+	}
+	if started := sc.started.Load(); started != 0 {
+		p.Elapsed = time.Since(time.Unix(0, started))
+	}
+	return p
+}
+
+// Result holds the outcome of a Scan.
+type Result struct {
+	// Root is the scanned directory.
+	Root *NodeStat
+
+	// Errors lists entries which could not be read, sorted by path.
+	// If not empty, the totals are incomplete.
+	Errors []*fs.PathError
+
+	// Excluded is the number of entries skipped due to the Exclude
+	// option, and ExcludedBytes the apparent size of those which are
+	// not directories.
+	Excluded      int64
+	ExcludedBytes int64
+
+	// Cancelled is set if the scan was cancelled before reading every
+	// directory. Those which were not read are Incomplete.
+	Cancelled bool
+
+	// Unlisted lists files whose contents could not be read as
+	// archives (see Options.Archives), sorted by path. Unlike Errors,
+	// these do not make the totals incomplete, as the files are
+	// still counted.
+	Unlisted []*fs.PathError
+}
+
+// Scan walks the directory tree at root, on the local filesystem.
+// The returned error is only set if root itself could not be read;
+// errors in reading anything below it are recorded in the Result.
+func (sc *Scanner) Scan(root string) (*Result, error) {
+	return sc.ScanContext(context.Background(), root)
+}
+
+// ScanContext is like Scan, but stops reading directories once ctx is
+// done. The directories read so far are returned, as if the scan had
+// finished; see Result.Cancelled.
+func (sc *Scanner) ScanContext(ctx context.Context, root string) (*Result, error) {
+	if sc.opts.Follow == FollowNever {
+		// os.DirFS always follows the link to its root.
+		info, err := os.Lstat(root)
+		if err != nil {
+			return nil, err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			s := newNodeStat(root)
+			s.type_ = "l"
+			s.size = info.Size()
+			s.usage = allocated(info)
+			s.mtime = info.ModTime().UnixNano()
+			s.atime = accessed(info)
+			s.owner = owner(info)
+			s.SetApparentSize(sc.opts.ApparentSize)
+			return &Result{Root: s}, nil
+		}
+	}
+	return sc.scan(ctx, os.DirFS(root), ".", root)
+}
+
+// ScanFS walks the directory tree at name, within fsys. The paths of
+// the resulting nodes are also names within fsys. The directory name
+// is always followed, even if it is a symbolic link.
+//
+// The allocated size, hard links, and filesystem boundaries are only
+// known if fsys reports them in the same way as os.DirFS does;
+// otherwise, all sizes are apparent sizes.
+func (sc *Scanner) ScanFS(fsys fs.FS, name string) (*Result, error) {
+	return sc.ScanFSContext(context.Background(), fsys, name)
+}
+
+// ScanFSContext is like ScanFS, but stops reading directories once ctx
+// is done, as ScanContext does.
+func (sc *Scanner) ScanFSContext(ctx context.Context, fsys fs.FS, name string) (*Result, error) {
+	return sc.scan(ctx, fsys, name, name)
+}
+
+// scan walks the directory name within fsys, naming the resulting
+// nodes with paths under prefix.
+func (sc *Scanner) scan(ctx context.Context, fsys fs.FS, name, prefix string) (*Result, error) {
+	sc.started.Store(time.Now().UnixNano())
+	sc.entries.Store(0)
+	sc.bytes.Store(0)
+	sc.dir.Store(nil)
+
+	s := newNodeStat(prefix)
+	w := &walker{
+		Scanner: sc,
+		ctx:     ctx,
+		fsys:    fsys,
+		base:    name,
+		sem:     make(chan struct{}, max(sc.opts.Jobs-1, 0)),
+		verify:  sc.opts.Verify,
+	}
+	if prev := sc.opts.Previous; prev != nil && !samePatterns(prev.Exclude, sc.opts.Exclude) {
+		// The entries of Previous were chosen with other patterns.
+		w.verify = true
+	}
+	if err := w.walkRoot(s); err != nil {
+		return nil, w.pathError(s.path, err)
+	}
+	w.wg.Wait()
+	if !sc.opts.CountLinks {
+		s.dedup(map[fileID]bool{}, sc.opts.Follow == FollowAll)
+	}
+	s.SetApparentSize(sc.opts.ApparentSize)
+	// Sum up the totals now, rather than on the first call to Total.
+	s.sum()
+	for _, errs := range [][]*fs.PathError{w.errs, w.unlisted} {
+		slices.SortFunc(errs, func(a, b *fs.PathError) int {
+			return strings.Compare(a.Path, b.Path)
+		})
+	}
+	return &Result{
+		Root:          s,
+		Errors:        w.errs,
+		Excluded:      w.excludedEntries.Load(),
+		ExcludedBytes: w.excludedBytes.Load(),
+		Cancelled:     w.cancelled.Load(),
+		Unlisted:      w.unlisted,
+	}, nil
+}
+
+// walker holds the state of a single scan, and bounds the number of
+// directories being read concurrently. The goroutine calling Scan
+// counts as one of the workers, hence the semaphore holds one token
+// less than the number of jobs.
+type walker struct {
+	*Scanner
+	ctx  context.Context
+	fsys fs.FS
+	base string // name of the scanned directory within fsys
+	sem  chan struct{}
+	wg   sync.WaitGroup
+	dev  uint64 // with OneFilesystem, the filesystem being scanned
+
+	// verify reads every directory, rather than reusing Previous.
+	verify bool
+
+	excludedEntries atomic.Int64
+	excludedBytes   atomic.Int64
+	cancelled       atomic.Bool
+
+	mu       sync.Mutex
+	errs     []*fs.PathError
+	unlisted []*fs.PathError // see Result.Unlisted
+}
+
+// walkRoot walks the directory s, which is the root of the scan.
+func (w *walker) walkRoot(s *NodeStat) error {
+	if w.opts.OneFilesystem {
+		info, err := fs.Stat(w.fsys, w.base)
+		if err != nil {
+			return err
+		}
+		id, _ := inode(info)
+		w.dev = id.dev
+	}
+	var prev *NodeStat
+	if w.opts.Previous != nil {
+		prev = w.opts.Previous.Root
+	}
+	return w.walk(s, ".", prev)
+}
+
+// pathError returns err as reported for the node at path. Errors
+// from fsys name the entry relative to fsys, rather than by path.
+func (w *walker) pathError(path string, err error) *fs.PathError {
+	var perr *fs.PathError
+	if errors.As(err, &perr) {
+		return &fs.PathError{Op: perr.Op, Path: path, Err: perr.Err}
+	}
+	return &fs.PathError{Op: "walk", Path: path, Err: err}
+}
+
+// fail records an error encountered while reading path.
+func (w *walker) fail(path string, err error) {
+	perr := w.pathError(path, err)
+	w.mu.Lock()
+	w.errs = append(w.errs, perr)
+	w.mu.Unlock()
+}
+
+// unlist records that the file at path could not be read as an
+// archive.
+func (w *walker) unlist(path string, err error) {
+	perr := w.pathError(path, err)
+	w.mu.Lock()
+	w.unlisted = append(w.unlisted, perr)
+	w.mu.Unlock()
+}
+
+// spawn walks s in a new goroutine if a worker is available, or
+// inline otherwise, so that a full pool never blocks the caller.
+func (w *walker) spawn(s, prev *NodeStat, rel string) {
+	select {
+	case w.sem <- struct{}{}:
+		w.wg.Add(1)
+		go func() {
+			defer func() {
+				<-w.sem
+				w.wg.Done()
+			}()
+			if err := w.walk(s, rel, prev); err != nil {
+				s.incomplete = true
+				w.fail(s.path, err)
+			}
+		}()
+	default:
+		if err := w.walk(s, rel, prev); err != nil {
+			s.incomplete = true
+			w.fail(s.path, err)
+		}
+	}
+}
+
+// exclude counts d as excluded. The size of directories is not known
+// without scanning them, so only files contribute to the bytes.
+func (w *walker) exclude(d fs.DirEntry) {
+	w.excludedEntries.Add(1)
+	if !d.IsDir() {
+		if info, err := d.Info(); err == nil {
+			w.excludedBytes.Add(info.Size())
+		}
+	}
+}
+
+// classify sets the type of child from its directory entry d, and
+// the size of anything that is not a directory. The name of child
+// within fsys is name.
+func (w *walker) classify(child *NodeStat, name string, d fs.DirEntry) error {
+	mode := d.Type()
+	var info fs.FileInfo
+	if mode&fs.ModeSymlink != 0 && w.opts.Follow == FollowAll {
+		var err error
+		if info, err = fs.Stat(w.fsys, name); err == nil {
+			mode = info.Mode().Type()
+			child.followed = true
+		} else {
+			// Dangling link; count the link itself.
+			w.fail(child.path, err)
+		}
+	}
+	if info == nil || mode&fs.ModeSymlink != 0 {
+		var err error
+		if info, err = d.Info(); err != nil {
+			child.type_ = "?"
+			return err
+		}
+	}
+	child.mtime = info.ModTime().UnixNano()
+	child.atime = accessed(info)
+	child.owner = owner(info)
+	switch {
+	case mode.IsDir():
+		child.type_ = "d"
+		if id, _ := inode(info); w.opts.OneFilesystem && id.dev != w.dev {
+			child.type_ = "m"
+		}
+		// The size of a directory is recorded when walking it.
+		return nil
+	case mode.IsRegular():
+		child.type_ = "f"
+	case mode&fs.ModeSymlink != 0:
+		child.type_ = "l"
+	default:
+		child.type_ = "?"
+	}
+	child.size = info.Size()
+	child.usage = allocated(info)
+	child.id, child.nlink = inode(info)
+	if w.opts.Archives && child.type_ == "f" && isArchive(child) {
+		if err := w.archive(child, name); err != nil {
+			w.unlist(child.path, err)
+		}
+	}
+	return nil
+}
+
+// walk reads the directory s, whose path relative to the scan root
+// is rel, and spawns walks of its subdirectories. Errors in reading
+// the entries of s are recorded, and do not stop the walk. If prev is
+// set, it is the same directory in the Previous scan.
+func (w *walker) walk(s *NodeStat, rel string, prev *NodeStat) error {
+	if w.ctx.Err() != nil {
+		// Leave the directory empty, but still finish the walk of
+		// the others, which is quick once they are all skipped.
+		s.incomplete = true
+		w.cancelled.Store(true)
+		return nil
+	}
+	w.dir.Store(&s.path)
+	name := path.Join(w.base, rel)
+	info, err := fs.Stat(w.fsys, name)
+	if err != nil {
+		return err
+	}
+	s.id, _ = inode(info)
+	s.owner = owner(info)
+	if s.id != (fileID{}) && s.loops() {
+		return &fs.PathError{Op: "walk", Path: s.path, Err: ErrLoop}
+	}
+	if w.opts.OneFilesystem && s.id.dev != w.dev {
+		// Only possible for directories taken from Previous.
+		s.type_ = "m"
+		return nil
+	}
+	// Directories take up space of their own; only count it towards
+	// the allocated size, as du does.
+	s.usage = allocated(info)
+	s.mtime = info.ModTime().UnixNano()
+	s.atime = accessed(info)
+
+	var prevs []*NodeStat
+	if w.unchanged(s, prev) {
+		prevs = w.reuse(s, rel, prev)
+	} else {
+		if prevs, err = w.read(s, rel, prev); err != nil {
+			return err
+		}
+	}
+	var bytes int64
+	for _, child := range s.children {
+		if w.opts.ApparentSize {
+			bytes += child.size
+		} else {
+			bytes += child.usage
+		}
+	}
+	w.entries.Add(int64(len(s.children)))
+	w.bytes.Add(bytes)
+
+	for i, child := range s.children {
+		if child.type_ == "d" {
+			w.spawn(child, prevs[i], path.Join(rel, path.Base(child.path)))
+		}
+	}
+	return nil
+}
+
+// unchanged reports whether the directory s is the same as prev, and
+// so does not need to be read again.
+func (w *walker) unchanged(s, prev *NodeStat) bool {
+	if prev == nil || w.verify || prev.incomplete ||
+		prev.type_ != "d" && prev.type_ != " " ||
+		prev.id != s.id || prev.mtime == 0 || prev.mtime != s.mtime {
+		return false
+	}
+	// Following symbolic links or not changes the type of their
+	// entries, which is only known by reading the directory.
+	followAll := w.opts.Follow == FollowAll
+	for _, p := range prev.children {
+		if p.followed && !followAll || p.type_ == "l" && followAll {
+			return false
+		}
+	}
+	return true
+}
+
+// read reads the entries of the directory s, and returns the entries
+// in prev with the same names as the children of s (or nil, for those
+// which are new).
+func (w *walker) read(s *NodeStat, rel string, prev *NodeStat) ([]*NodeStat, error) {
+	name := path.Join(w.base, rel)
+	// fs.ReadDir sorts the entries by name, so that the resulting
+	// tree does not depend on the order of the underlying directory.
+	dirEntries, err := fs.ReadDir(w.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	var previous map[string]*NodeStat
+	if prev != nil {
+		previous = make(map[string]*NodeStat, len(prev.children))
+		for _, p := range prev.children {
+			previous[path.Base(p.path)] = p
+		}
+	}
+
+	// Populate all children before descending, so that the shape of
+	// the tree does not depend on the order in which goroutines run.
+	s.children = make([]*NodeStat, 0, len(dirEntries))
+	prevs := make([]*NodeStat, 0, len(dirEntries))
+	for _, d := range dirEntries {
+		if len(w.excludes) > 0 && w.excludes.match(path.Join(rel, d.Name())) {
+			w.exclude(d)
+			continue
+		}
+		fpath := path.Join(s.path, d.Name())
+		child := newNodeStat(fpath)
+		child.parent = s
+		s.children = append(s.children, child)
+		prevs = append(prevs, previous[d.Name()])
+		if err := w.classify(child, path.Join(name, d.Name()), d); err != nil {
+			w.fail(fpath, err)
+		}
+	}
+	return prevs, nil
+}
+
+// reuse takes the entries of the directory s from prev, rather than
+// reading it again. Entries other than links and directories are
+// classified again: writing to a file does not change the
+// modification time of its directory, nor does mounting another
+// filesystem (or Options.OneFilesystem changing), and entries which
+// could not be read before may be readable now. Returns the entries
+// of prev, corresponding to the children of s.
+func (w *walker) reuse(s *NodeStat, rel string, prev *NodeStat) []*NodeStat {
+	name := path.Join(w.base, rel)
+	s.children = make([]*NodeStat, 0, len(prev.children))
+	prevs := make([]*NodeStat, 0, len(prev.children))
+	for _, p := range prev.children {
+		base := path.Base(p.path)
+		child := newNodeStat(path.Join(s.path, base))
+		child.parent = s
+		child.type_ = p.type_
+		child.followed = p.followed
+		s.children = append(s.children, child)
+		prevs = append(prevs, p)
+		switch p.type_ {
+		case "d":
+			// Walked later.
+		case "l":
+			// Links can only be replaced, which changes the
+			// modification time of the directory.
+			child.size, child.usage, child.mtime = p.size, p.usage, p.mtime
+			child.atime = p.atime
+			child.id, child.nlink = p.id, p.nlink
+			child.owner = p.owner
+		default:
+			info, err := fs.Stat(w.fsys, path.Join(name, base))
+			if err != nil {
+				child.type_ = "?"
+				w.fail(child.path, err)
+				continue
+			}
+			d := fs.FileInfoToDirEntry(info)
+			if err := w.classify(child, path.Join(name, base), d); err != nil {
+				w.fail(child.path, err)
+			}
+		}
+	}
+	return prevs
+}
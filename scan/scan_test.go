@@ -0,0 +1,173 @@
+package scan
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// dump describes every entry of the tree under s, one per line, to
+// compare trees. Access times are left out, as scanning changes those
+// of directories.
+func dump(s *NodeStat) []string {
+	var lines []string
+	var walk func(s *NodeStat)
+	walk = func(s *NodeStat) {
+		lines = append(lines, fmt.Sprintf(
+			"%s [%s] size=%d usage=%d mtime=%d id=%v nlink=%d linked=%v followed=%v incomplete=%v total=%d files=%d",
+			s.path, s.type_, s.size, s.usage, s.mtime, s.id, s.nlink,
+			s.linked, s.followed, s.incomplete, s.Total(), s.Files(),
+		))
+		for _, child := range s.children {
+			walk(child)
+		}
+	}
+	walk(s)
+	return lines
+}
+
+// diffLines returns the lines which are only in a, or only in b.
+func diffLines(a, b []string) (onlyA, onlyB []string) {
+	for _, line := range a {
+		if !slices.Contains(b, line) {
+			onlyA = append(onlyA, line)
+		}
+	}
+	for _, line := range b {
+		if !slices.Contains(a, line) {
+			onlyB = append(onlyB, line)
+		}
+	}
+	return onlyA, onlyB
+}
+
+// makeTree creates a small tree under dir, with modification times in
+// the past, so that any later change shows up even on filesystems with
+// coarse timestamps.
+func makeTree(t *testing.T, dir string) {
+	t.Helper()
+	files := map[string]string{
+		"root/a/f1":             "0123456789",
+		"root/a/f2":             "01234",
+		"root/b/c/f3":           "012",
+		"root/node_modules/x/y": "0123456789012345",
+		"outside/o":             "0123",
+	}
+	for name, data := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Link(filepath.Join(dir, "root", "a", "f1"), filepath.Join(dir, "root", "b", "hard")); err != nil {
+		t.Skip(err)
+	}
+	if err := os.Symlink("../outside", filepath.Join(dir, "root", "link")); err != nil {
+		t.Skip(err)
+	}
+	past := time.Now().Add(-time.Hour)
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.Mode()&os.ModeSymlink != 0 {
+			return err
+		}
+		return os.Chtimes(p, past, past)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIncrementalMatchesFullScan(t *testing.T) {
+	exclude := []string{"node_modules"}
+	for _, tt := range []struct {
+		name       string
+		prev, next Options
+		change     func(root string) error
+	}{
+		{name: "unchanged"},
+		{
+			name: "grow file",
+			change: func(root string) error {
+				f, err := os.OpenFile(filepath.Join(root, "a", "f1"), os.O_APPEND|os.O_WRONLY, 0)
+				if err != nil {
+					return err
+				}
+				f.WriteString("more")
+				return f.Close()
+			},
+		},
+		{
+			name: "add entry",
+			change: func(root string) error {
+				return os.WriteFile(filepath.Join(root, "b", "c", "new"), []byte("new"), 0o644)
+			},
+		},
+		{
+			name: "remove entry",
+			change: func(root string) error {
+				return os.RemoveAll(filepath.Join(root, "b", "c"))
+			},
+		},
+		{
+			name: "replace file with directory",
+			change: func(root string) error {
+				p := filepath.Join(root, "a", "f2")
+				if err := os.Remove(p); err != nil {
+					return err
+				}
+				if err := os.Mkdir(p, 0o755); err != nil {
+					return err
+				}
+				return os.WriteFile(filepath.Join(p, "g"), []byte("g"), 0o644)
+			},
+		},
+		{name: "follow links", next: Options{Follow: FollowAll}},
+		{name: "stop following links", prev: Options{Follow: FollowAll}},
+		{name: "one filesystem", next: Options{OneFilesystem: true}},
+		{name: "all filesystems", prev: Options{OneFilesystem: true}},
+		{name: "exclude", next: Options{Exclude: exclude}},
+		{name: "stop excluding", prev: Options{Exclude: exclude}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			makeTree(t, dir)
+			root := filepath.Join(dir, "root")
+			scanWith := func(opts Options) *NodeStat {
+				t.Helper()
+				sc, err := NewScanner(opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				result, err := sc.Scan(root)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(result.Errors) > 0 {
+					t.Fatalf("errors: %v", result.Errors)
+				}
+				return result.Root
+			}
+
+			prev := scanWith(tt.prev)
+			if tt.change != nil {
+				if err := tt.change(root); err != nil {
+					t.Fatal(err)
+				}
+			}
+			opts := tt.next
+			opts.Previous = &Snapshot{Root: prev, Exclude: tt.prev.Exclude}
+			incremental := dump(scanWith(opts))
+			full := dump(scanWith(tt.next))
+			if onlyIncr, onlyFull := diffLines(incremental, full); onlyIncr != nil || onlyFull != nil {
+				t.Errorf("incremental scan differs from full scan:\nonly incremental: %q\nonly full: %q",
+					onlyIncr, onlyFull)
+			}
+		})
+	}
+}
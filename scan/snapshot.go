@@ -0,0 +1,250 @@
+package scan
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+)
+
+// A snapshot starts with snapshotMagic and the version, followed by a
+// gzip stream. The stream starts with the exclude patterns of the
+// scan:
+//
+//	uvarint  number of patterns
+//	uvarint  length of pattern, for each pattern
+//	bytes    pattern, for each pattern
+//
+// followed by the nodes in depth-first order. Each node is encoded as:
+//
+//	uvarint  length of name
+//	bytes    name (the full path for the root, or the base name)
+//	byte     type
+//	byte     flags (flagLinked, flagIncomplete, flagOwner, flagFollowed)
+//	varint   apparent size
+//	varint   allocated size
+//	varint   modification time, in Unix nanoseconds
+//	varint   access time, in Unix nanoseconds
+//	uvarint  device
+//	uvarint  inode
+//	uvarint  number of hard links
+//	uvarint  user ID, only with flagOwner
+//	uvarint  group ID, only with flagOwner
+//	uvarint  number of children, which follow
+const (
+	snapshotMagic   = "dua snapshot "
+	snapshotVersion = 1
+)
+
+const (
+	flagLinked = 1 << iota
+	flagIncomplete
+	flagOwner
+	flagFollowed
+)
+
+// maxNameLen bounds the length of names and patterns in a snapshot,
+// so that a corrupt one cannot make ReadSnapshot allocate without
+// bounds before the gzip checksum is verified.
+const maxNameLen = 4096
+
+// errNameTooLong is returned for names longer than maxNameLen.
+var errNameTooLong = errors.New("name too long")
+
+// ErrNotSnapshot is returned when reading a file which is not a
+// snapshot written by WriteSnapshot.
+var ErrNotSnapshot = errors.New("not a dua snapshot")
+
+// Snapshot is a scanned tree, as saved with WriteSnapshot, and the
+// Exclude patterns (see Options) it was scanned with.
+type Snapshot struct {
+	Root    *NodeStat
+	Exclude []string
+}
+
+// WriteSnapshot writes snap to w, in a compact format which can be
+// read back with ReadSnapshot.
+func WriteSnapshot(w io.Writer, snap *Snapshot) error {
+	if _, err := fmt.Fprintf(w, "%s%d\n", snapshotMagic, snapshotVersion); err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(w)
+	bw := bufio.NewWriter(zw)
+	var buf [binary.MaxVarintLen64]byte
+	bw.Write(buf[:binary.PutUvarint(buf[:], uint64(len(snap.Exclude)))])
+	for _, p := range snap.Exclude {
+		bw.Write(buf[:binary.PutUvarint(buf[:], uint64(len(p)))])
+		bw.WriteString(p)
+	}
+	writeSnapshot(bw, snap.Root, snap.Root.path)
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeSnapshot(w *bufio.Writer, s *NodeStat, name string) {
+	var buf [binary.MaxVarintLen64]byte
+	uvarint := func(x uint64) {
+		w.Write(buf[:binary.PutUvarint(buf[:], x)])
+	}
+	varint := func(x int64) {
+		w.Write(buf[:binary.PutVarint(buf[:], x)])
+	}
+	uvarint(uint64(len(name)))
+	w.WriteString(name)
+	w.WriteByte(s.type_[0])
+	var flags byte
+	if s.linked {
+		flags |= flagLinked
+	}
+	if s.incomplete {
+		flags |= flagIncomplete
+	}
+	if s.owner.known {
+		flags |= flagOwner
+	}
+	if s.followed {
+		flags |= flagFollowed
+	}
+	w.WriteByte(flags)
+	varint(s.size)
+	varint(s.usage)
+	varint(s.mtime)
+	varint(s.atime)
+	uvarint(s.id.dev)
+	uvarint(s.id.ino)
+	uvarint(s.nlink)
+	if s.owner.known {
+		uvarint(uint64(s.owner.uid))
+		uvarint(uint64(s.owner.gid))
+	}
+	uvarint(uint64(len(s.children)))
+	for _, child := range s.children {
+		writeSnapshot(w, child, path.Base(child.path))
+	}
+}
+
+// ReadSnapshot reads a snapshot written by WriteSnapshot.
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(snapshotMagic)+2)
+	_, err := io.ReadFull(br, magic)
+	if err != nil || string(magic[:len(snapshotMagic)]) != snapshotMagic || magic[len(magic)-1] != '\n' {
+		return nil, ErrNotSnapshot
+	}
+	if version := int(magic[len(magic)-2] - '0'); version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version: %c", magic[len(magic)-2])
+	}
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	zbr := bufio.NewReader(zr)
+	exclude, err := readPatterns(zbr)
+	var root *NodeStat
+	if err == nil {
+		root, err = readSnapshot(zbr, nil)
+	}
+	if err == nil {
+		// Read up to the end of the stream, where gzip verifies its
+		// checksum.
+		if _, err = zbr.ReadByte(); err == nil {
+			err = errors.New("unexpected data after the tree")
+		} else if err == io.EOF {
+			err = nil
+		}
+	}
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("reading snapshot: %w", err)
+	}
+	return &Snapshot{Root: root, Exclude: exclude}, nil
+}
+
+func readPatterns(r *bufio.Reader) ([]string, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	var ps []string
+	for i := uint64(0); i < n; i++ {
+		size, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		if size > maxNameLen {
+			return nil, errNameTooLong
+		}
+		p := make([]byte, size)
+		if _, err := io.ReadFull(r, p); err != nil {
+			return nil, err
+		}
+		ps = append(ps, string(p))
+	}
+	return ps, nil
+}
+
+func readSnapshot(r *bufio.Reader, parent *NodeStat) (*NodeStat, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxNameLen {
+		return nil, errNameTooLong
+	}
+	name := make([]byte, n)
+	if _, err := io.ReadFull(r, name); err != nil {
+		return nil, err
+	}
+	s := newNodeStat(string(name))
+	if parent != nil {
+		s.path = path.Join(parent.path, s.path)
+		s.parent = parent
+	}
+	var fixed [2]byte
+	if _, err := io.ReadFull(r, fixed[:]); err != nil {
+		return nil, err
+	}
+	s.type_ = string(fixed[:1])
+	s.linked = fixed[1]&flagLinked != 0
+	s.incomplete = fixed[1]&flagIncomplete != 0
+	s.owner.known = fixed[1]&flagOwner != 0
+	s.followed = fixed[1]&flagFollowed != 0
+	for _, v := range []*int64{&s.size, &s.usage, &s.mtime, &s.atime} {
+		if *v, err = binary.ReadVarint(r); err != nil {
+			return nil, err
+		}
+	}
+	for _, v := range []*uint64{&s.id.dev, &s.id.ino, &s.nlink} {
+		if *v, err = binary.ReadUvarint(r); err != nil {
+			return nil, err
+		}
+	}
+	if s.owner.known {
+		for _, v := range []*uint32{&s.owner.uid, &s.owner.gid} {
+			id, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, err
+			}
+			*v = uint32(id)
+		}
+	}
+	if n, err = binary.ReadUvarint(r); err != nil {
+		return nil, err
+	}
+	s.children = make([]*NodeStat, 0, min(n, 1<<16))
+	for i := uint64(0); i < n; i++ {
+		child, err := readSnapshot(r, s)
+		if err != nil {
+			return nil, err
+		}
+		s.children = append(s.children, child)
+	}
+	return s, nil
+}
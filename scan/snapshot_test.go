@@ -0,0 +1,118 @@
+package scan
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+// dumpAll is dump, with the access times and owners as well.
+func dumpAll(s *NodeStat) []string {
+	lines := dump(s)
+	i := 0
+	var walk func(s *NodeStat)
+	walk = func(s *NodeStat) {
+		lines[i] += fmt.Sprintf(" atime=%d owner=%v", s.atime, s.owner)
+		i++
+		for _, child := range s.children {
+			walk(child)
+		}
+	}
+	walk(s)
+	return lines
+}
+
+func roundTrip(t *testing.T, snap *Snapshot) *Snapshot {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := WriteSnapshot(&buf, snap); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadSnapshot(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return read
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		fsys := randomFS(r, r.Intn(40))
+		sc, err := NewScanner(Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := sc.ScanFS(fsys, "root")
+		if err != nil {
+			t.Fatal(err)
+		}
+		exclude := []string{"*.log", "build/**"}[:r.Intn(3)]
+		read := roundTrip(t, &Snapshot{Root: result.Root, Exclude: exclude})
+		if got, want := dumpAll(read.Root), dumpAll(result.Root); !slices.Equal(got, want) {
+			t.Errorf("tree %d:\ngot  %q\nwant %q", i, got, want)
+		}
+		if !slices.Equal(read.Exclude, exclude) {
+			t.Errorf("tree %d: got exclude %q, want %q", i, read.Exclude, exclude)
+		}
+	}
+}
+
+func TestSnapshotRoundTripDisk(t *testing.T) {
+	// Inodes, hard links, owners and followed links only come from
+	// the disk.
+	dir := t.TempDir()
+	makeTree(t, dir)
+	sc, err := NewScanner(Options{Follow: FollowAll})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := sc.Scan(filepath.Join(dir, "root"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := roundTrip(t, &Snapshot{Root: result.Root})
+	if got, want := dumpAll(read.Root), dumpAll(result.Root); !slices.Equal(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestSnapshotCorrupt(t *testing.T) {
+	sc, err := NewScanner(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := sc.ScanFS(fstest.MapFS{
+		"root/a/b": {Data: []byte("data")},
+		"root/c":   {Data: []byte("more data")},
+	}, "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteSnapshot(&buf, &Snapshot{Root: result.Root, Exclude: []string{"x"}}); err != nil {
+		t.Fatal(err)
+	}
+	valid := buf.Bytes()
+	for n := 0; n < len(valid); n++ {
+		if _, err := ReadSnapshot(bytes.NewReader(valid[:n])); err == nil {
+			t.Errorf("truncated to %d bytes: no error", n)
+		}
+	}
+
+	// A name far longer than any path, before the gzip checksum could
+	// tell that the snapshot is corrupt.
+	var long bytes.Buffer
+	fmt.Fprintf(&long, "%s%d\n", snapshotMagic, snapshotVersion)
+	zw := gzip.NewWriter(&long)
+	zw.Write([]byte{0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01})
+	zw.Close()
+	if _, err := ReadSnapshot(&long); err == nil {
+		t.Error("overlong name: no error")
+	}
+}
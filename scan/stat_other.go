@@ -0,0 +1,30 @@
+//go:build !unix
+
+package scan
+
+import (
+	"io/fs"
+)
+
+// allocated returns the apparent size of the file, as this platform
+// does not report the number of allocated blocks.
+func allocated(info fs.FileInfo) int64 {
+	return info.Size()
+}
+
+// inode always reports a single link, as this platform does not
+// expose inode numbers through fs.FileInfo.
+func inode(info fs.FileInfo) (id fileID, nlink uint64) {
+	return fileID{}, 1
+}
+
+// accessed returns the modification time, as this platform does not
+// report the access time through fs.FileInfo.
+func accessed(info fs.FileInfo) int64 {
+	return info.ModTime().UnixNano()
+}
+
+// owner reports no owner, as this platform has no user and group IDs.
+func owner(info fs.FileInfo) fileOwner {
+	return fileOwner{}
+}
@@ -0,0 +1,45 @@
+//go:build unix
+
+package scan
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// allocated returns the number of bytes actually allocated on disk
+// for the file described by info, as reported by stat(2).
+func allocated(info fs.FileInfo) int64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		// st_blocks is always counted in 512-byte units, regardless
+		// of the filesystem's block size.
+		return int64(st.Blocks) * 512
+	}
+	return info.Size()
+}
+
+// inode returns the device and inode numbers identifying the file
+// described by info, and the number of hard links pointing to it.
+func inode(info fs.FileInfo) (id fileID, nlink uint64) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return fileID{uint64(st.Dev), uint64(st.Ino)}, uint64(st.Nlink)
+	}
+	return fileID{}, 1
+}
+
+// accessed returns the time the file described by info was last
+// accessed, in Unix nanoseconds.
+func accessed(info fs.FileInfo) int64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return atime(st)
+	}
+	return info.ModTime().UnixNano()
+}
+
+// owner returns the user and group owning the file described by info.
+func owner(info fs.FileInfo) fileOwner {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return fileOwner{uid: st.Uid, gid: st.Gid, known: true}
+	}
+	return fileOwner{}
+}
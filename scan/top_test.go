@@ -0,0 +1,118 @@
+package scan
+
+import (
+	"cmp"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// randomFS returns a tree of up to about n entries, with sizes from a
+// small set, so that many entries tie.
+func randomFS(r *rand.Rand, n int) fstest.MapFS {
+	fsys := fstest.MapFS{}
+	dirs := []string{"root"}
+	for i := 0; i < n; i++ {
+		dir := dirs[r.Intn(len(dirs))]
+		name := fmt.Sprintf("%s/%c", dir, 'a'+r.Intn(6))
+		if _, ok := fsys[name]; ok || slices.Contains(dirs, name) {
+			continue
+		}
+		if r.Intn(3) == 0 {
+			dirs = append(dirs, name)
+			if r.Intn(4) == 0 {
+				// Listed even if it stays empty.
+				fsys[name] = &fstest.MapFile{Mode: fs.ModeDir | 0o755}
+			}
+			continue
+		}
+		sizes := []int{0, 1, 2, 5, 10}
+		fsys[name] = &fstest.MapFile{Data: make([]byte, sizes[r.Intn(len(sizes))])}
+	}
+	if len(fsys) == 0 {
+		fsys["root"] = &fstest.MapFile{Mode: fs.ModeDir | 0o755}
+	}
+	return fsys
+}
+
+// bruteTop is Top, the slow way: collect every candidate, sort them
+// all, and keep the first n.
+func bruteTop(s *NodeStat, n int, threshold float64) []*NodeStat {
+	var all []*NodeStat
+	var walk func(s *NodeStat)
+	walk = func(s *NodeStat) {
+		includeSelf := true
+		for _, child := range s.Children() {
+			if float64(child.Total()) > float64(s.Total())*threshold {
+				includeSelf = false
+			}
+			walk(child)
+		}
+		if includeSelf {
+			all = append(all, s)
+		}
+	}
+	walk(s)
+	slices.SortFunc(all, func(a, b *NodeStat) int {
+		if c := cmp.Compare(b.Total(), a.Total()); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Path(), b.Path())
+	})
+	if n > 0 && len(all) > n {
+		all = all[:n]
+	}
+	return all
+}
+
+func paths(nodes []*NodeStat) []string {
+	ps := make([]string, len(nodes))
+	for i, s := range nodes {
+		ps[i] = fmt.Sprintf("%s=%d", s.Path(), s.Total())
+	}
+	return ps
+}
+
+func TestTopMatchesBruteForce(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 300; i++ {
+		fsys := randomFS(r, r.Intn(40))
+		var want map[string][]string
+		for _, jobs := range []int{1, 2, 8} {
+			sc, err := NewScanner(Options{Jobs: jobs, ApparentSize: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := sc.ScanFS(fsys, "root")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string][]string{}
+			for _, n := range []int{0, 1, 3, 10} {
+				for _, threshold := range []float64{0, 0.3, 0.5, 0.9, 1} {
+					key := fmt.Sprintf("n=%d threshold=%v", n, threshold)
+					got[key] = paths(Top(result.Root, n, threshold))
+					brute := paths(bruteTop(result.Root, n, threshold))
+					if !slices.Equal(got[key], brute) {
+						t.Fatalf("tree %d, jobs=%d, %s:\ngot  %v\nwant %v",
+							i, jobs, key, got[key], brute)
+					}
+				}
+			}
+			if want == nil {
+				want = got
+				continue
+			}
+			for key := range want {
+				if !slices.Equal(got[key], want[key]) {
+					t.Fatalf("tree %d, %s: jobs=%d gives %v, jobs=1 gives %v",
+						i, key, jobs, got[key], want[key])
+				}
+			}
+		}
+	}
+}
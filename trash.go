@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// trashDir returns the home trash directory, as described by the
+// freedesktop.org Trash specification:
+// https://specifications.freedesktop.org/trash-spec/latest/
+func trashDir() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "Trash"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "Trash"), nil
+}
+
+// moveToTrash moves the file or directory at p into the home trash,
+// recording where it came from, so that it can be restored by any
+// compliant file manager.
+func moveToTrash(p string) error {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return err
+	}
+	dir, err := trashDir()
+	if err != nil {
+		return err
+	}
+	files := filepath.Join(dir, "files")
+	info := filepath.Join(dir, "info")
+	if err := os.MkdirAll(files, 0o700); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(info, 0o700); err != nil {
+		return err
+	}
+
+	// Creating the .trashinfo file exclusively reserves the name in
+	// the trash; try name, name.2, name.3, and so on.
+	base := filepath.Base(abs)
+	name := base
+	var f *os.File
+	for i := 2; ; i++ {
+		f, err = os.OpenFile(
+			filepath.Join(info, name+".trashinfo"),
+			os.O_WRONLY|os.O_CREATE|os.O_EXCL,
+			0o600,
+		)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return err
+		}
+		name = fmt.Sprintf("%s.%d", base, i)
+	}
+	_, err = fmt.Fprintf(f,
+		"[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: abs}).EscapedPath(),
+		time.Now().Format("2006-01-02T15:04:05"),
+	)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(abs, filepath.Join(files, name))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		if crossDevice(err) {
+			return fmt.Errorf("%s: cannot move to %s from another filesystem", p, dir)
+		}
+		return err
+	}
+	return nil
+}
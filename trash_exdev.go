@@ -0,0 +1,14 @@
+//go:build !plan9
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// crossDevice reports whether err is due to renaming a file across
+// filesystems.
+func crossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
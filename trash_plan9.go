@@ -0,0 +1,9 @@
+//go:build plan9
+
+package main
+
+// crossDevice reports whether err is due to renaming a file across
+// filesystems; Plan 9 has no such error.
+func crossDevice(err error) bool {
+	return false
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/rollcat/dua/scan"
+	"golang.org/x/term"
+)
+
+// browser is the state of the interactive view (-i). It either shows
+// the top entries under dir, or the children of dir, sorted by size.
+type browser struct {
+	root      *scan.NodeStat
+	dir       *scan.NodeStat
+	top       bool
+	entries   []*scan.NodeStat
+	cursor    int
+	offset    int
+	threshold float64
+	apparent  bool
+	message   string
+
+	// Entries marked for removal, and the action awaiting the user's
+	// confirmation (if any).
+	readonly bool
+	marked   map[*scan.NodeStat]bool
+	confirm  func()
+
+	out *bufio.Writer
+}
+
+// browse runs the interactive view over the tree under root, until
+// the user quits. Unless readonly is set, the user can remove entries
+// from the disk.
+func browse(root *scan.NodeStat, apparent, readonly bool) error {
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return errors.New("interactive mode requires a terminal")
+	}
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return err
+	}
+	defer term.Restore(int(os.Stdin.Fd()), state)
+
+	b := &browser{
+		root:      root,
+		threshold: threshold,
+		apparent:  apparent,
+		readonly:  readonly,
+		marked:    map[*scan.NodeStat]bool{},
+		out:       bufio.NewWriter(os.Stdout),
+	}
+	// Use the alternate screen, and hide the cursor.
+	b.out.WriteString("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		b.out.WriteString("\x1b[?25h\x1b[?1049l")
+		b.out.Flush()
+	}()
+
+	b.showTop(root)
+	buf := make([]byte, 16)
+	for {
+		b.render()
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return err
+		}
+		b.message = ""
+		if confirm := b.confirm; confirm != nil {
+			b.confirm = nil
+			if string(buf[:n]) == "y" {
+				confirm()
+			}
+			continue
+		}
+		if !b.handle(string(buf[:n])) {
+			return nil
+		}
+	}
+}
+
+// handle acts on a single key press, and reports whether to carry on.
+func (b *browser) handle(key string) bool {
+	switch key {
+	case "q", "\x03": // Ctrl-C
+		return false
+	case "k", "\x1b[A", "\x1bOA":
+		b.move(-1)
+	case "j", "\x1b[B", "\x1bOB":
+		b.move(1)
+	case "\x1b[5~": // Page Up
+		b.move(-b.pageSize())
+	case "\x1b[6~": // Page Down
+		b.move(b.pageSize())
+	case "g", "\x1b[H":
+		b.move(-len(b.entries))
+	case "G", "\x1b[F":
+		b.move(len(b.entries))
+	case "l", "\r", "\x1b[C", "\x1bOC":
+		b.enter()
+	case "h", "\x7f", "\x1b[D", "\x1bOD":
+		b.up()
+	case "t":
+		if b.top {
+			b.showChildren(b.dir, nil)
+		} else {
+			b.showTop(b.dir)
+		}
+	case "+", "=":
+		b.setThreshold(b.threshold + 0.05)
+	case "-":
+		b.setThreshold(b.threshold - 0.05)
+	case "a":
+		b.apparent = !b.apparent
+		b.root.SetApparentSize(b.apparent)
+		b.refresh()
+	case " ":
+		if len(b.entries) > 0 {
+			s := b.entries[b.cursor]
+			if b.marked[s] {
+				delete(b.marked, s)
+			} else {
+				b.marked[s] = true
+			}
+			b.move(1)
+		}
+	case "d":
+		b.remove("Move %d entries (%s) to the trash?", moveToTrash)
+	case "D":
+		b.remove("Delete %d entries (%s) permanently?", os.RemoveAll)
+	}
+	return true
+}
+
+// remove asks to confirm removing the marked entries (or the entry
+// under the cursor, if none are marked) with the given function, and
+// once confirmed, removes them from the disk and from the tree.
+func (b *browser) remove(prompt string, fn func(string) error) {
+	if b.readonly {
+		b.message = "Cannot remove entries which were not scanned from this disk."
+		return
+	}
+	targets := b.targets()
+	if len(targets) == 0 {
+		return
+	}
+	var total int64
+	for _, s := range targets {
+		if err := b.removable(s); err != nil {
+			b.message = err.Error()
+			return
+		}
+		total += s.Total()
+	}
+	b.message = fmt.Sprintf(prompt+" [y/N]", len(targets), strings.TrimSpace(fmtBytes(total)))
+	b.confirm = func() {
+		// Hard-linked files only free space once their last link is
+		// removed; until then, Remove counts them at another link.
+		before := b.root.Total()
+		for _, s := range targets {
+			if err := fn(s.Path()); err != nil {
+				b.message = err.Error()
+				break
+			}
+			delete(b.marked, s)
+			parent := s.Parent()
+			s.Remove()
+			// Leave the removed directory, if showing it or anything
+			// inside it.
+			if !b.attached(b.dir) {
+				b.dir = parent
+			}
+		}
+		if b.message == "" {
+			freed := before - b.root.Total()
+			b.message = fmt.Sprintf("Freed %s.", strings.TrimSpace(fmtBytes(freed)))
+		}
+		// Forget marks inside the removed directories.
+		for s := range b.marked {
+			if !b.attached(s) {
+				delete(b.marked, s)
+			}
+		}
+		b.refresh()
+	}
+}
+
+// attached reports whether s is still part of the tree under b.root,
+// rather than inside a removed entry.
+func (b *browser) attached(s *scan.NodeStat) bool {
+	for s.Parent() != nil {
+		s = s.Parent()
+	}
+	return s == b.root
+}
+
+// targets returns the entries to remove: the marked ones, except for
+// those inside other marked directories; or if none are marked, the
+// entry under the cursor.
+func (b *browser) targets() []*scan.NodeStat {
+	if len(b.marked) == 0 {
+		if len(b.entries) == 0 {
+			return nil
+		}
+		return []*scan.NodeStat{b.entries[b.cursor]}
+	}
+	var targets []*scan.NodeStat
+outer:
+	for s := range b.marked {
+		for p := s.Parent(); p != nil; p = p.Parent() {
+			if b.marked[p] {
+				continue outer
+			}
+		}
+		targets = append(targets, s)
+	}
+	slices.SortFunc(targets, func(x, y *scan.NodeStat) int {
+		return strings.Compare(x.Path(), y.Path())
+	})
+	return targets
+}
+
+// removable returns an error if s must not be removed: the root of
+// the scan, anything inside an archive or a followed symbolic link
+// (which may lead outside of the scan), and anything which is, or
+// contains, another filesystem or a followed symbolic link (removing
+// which would only remove the link).
+func (b *browser) removable(s *scan.NodeStat) error {
+	if s == b.root {
+		return fmt.Errorf("Refusing to remove %s: the scanned directory.", s.Path())
+	}
+	for p := s.Parent(); p != nil; p = p.Parent() {
+		if p.Type() == "a" {
+			return fmt.Errorf("Refusing to remove %s: inside an archive.", s.Path())
+		}
+		if p.Followed() {
+			return fmt.Errorf("Refusing to remove %s: inside a followed symbolic link.", s.Path())
+		}
+	}
+	dev := b.root.Dev()
+	var check func(s *scan.NodeStat) error
+	check = func(s *scan.NodeStat) error {
+		if s.Type() == "m" || s.Dev() != 0 && s.Dev() != dev {
+			return fmt.Errorf("Refusing to remove %s: on another filesystem.", s.Path())
+		}
+		if s.Followed() {
+			return fmt.Errorf("Refusing to remove %s: a followed symbolic link.", s.Path())
+		}
+		for _, child := range s.Children() {
+			if err := check(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return check(s)
+}
+
+// showTop lists the top entries under dir.
+func (b *browser) showTop(dir *scan.NodeStat) {
+	b.dir, b.top = dir, true
+	b.entries = scan.Top(dir, topn, b.threshold)
+	b.cursor, b.offset = 0, 0
+}
+
+// showChildren lists the children of dir, biggest first, with the
+// cursor on selected (if given).
+func (b *browser) showChildren(dir, selected *scan.NodeStat) {
+	b.dir, b.top = dir, false
+	b.entries = slices.Clone(dir.Children())
+	slices.SortStableFunc(b.entries, func(x, y *scan.NodeStat) int {
+		return cmp.Compare(y.Total(), x.Total())
+	})
+	b.cursor, b.offset = 0, 0
+	if i := slices.Index(b.entries, selected); i >= 0 {
+		b.cursor = i
+	}
+}
+
+// refresh lists the entries again, e.g. after their sizes changed,
+// keeping the cursor on the same entry if possible.
+func (b *browser) refresh() {
+	var selected *scan.NodeStat
+	if b.cursor < len(b.entries) {
+		selected = b.entries[b.cursor]
+	}
+	if b.top {
+		b.showTop(b.dir)
+		if i := slices.Index(b.entries, selected); i >= 0 {
+			b.cursor = i
+		}
+	} else {
+		b.showChildren(b.dir, selected)
+	}
+}
+
+func (b *browser) setThreshold(t float64) {
+	if !(0.0 < t && t < 1.0) {
+		b.message = "Threshold not in range (0.0 - 1.0)"
+		return
+	}
+	b.threshold = t
+	b.showTop(b.dir)
+}
+
+// enter shows the children of the entry under the cursor; or if it
+// has none, the directory containing it.
+func (b *browser) enter() {
+	if len(b.entries) == 0 {
+		return
+	}
+	s := b.entries[b.cursor]
+	switch {
+	case len(s.Children()) > 0:
+		b.showChildren(s, nil)
+	case b.top && s.Parent() != nil:
+		b.showChildren(s.Parent(), s)
+	}
+}
+
+// up shows the children of the parent of the current directory.
+func (b *browser) up() {
+	if b.top {
+		b.showChildren(b.dir, nil)
+		return
+	}
+	if parent := b.dir.Parent(); parent != nil {
+		b.showChildren(parent, b.dir)
+	}
+}
+
+func (b *browser) move(delta int) {
+	b.cursor = max(0, min(b.cursor+delta, len(b.entries)-1))
+}
+
+// pageSize returns the number of entries that fit on the screen.
+func (b *browser) pageSize() int {
+	_, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		height = 24
+	}
+	// Leave room for the header and the footer.
+	return max(height-3, 1)
+}
+
+func (b *browser) render() {
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		width = 80
+	}
+	page := b.pageSize()
+	if b.cursor < b.offset {
+		b.offset = b.cursor
+	} else if b.cursor >= b.offset+page {
+		b.offset = b.cursor - page + 1
+	}
+
+	mode := "allocated"
+	if b.apparent {
+		mode = "apparent"
+	}
+	view := "children of"
+	if b.top {
+		view = fmt.Sprintf("top %d (threshold %.2f) under", topn, b.threshold)
+	}
+	b.out.WriteString("\x1b[H\x1b[2J")
+	b.line(width, false, " %s %s %s [%s]",
+		fmtBytes(b.dir.Total()), view, b.dir.Path(), mode)
+	for i := b.offset; i < min(b.offset+page, len(b.entries)); i++ {
+		s := b.entries[i]
+		name := s.Path()
+		if !b.top {
+			name = path.Base(name)
+		}
+		mark := " "
+		if b.marked[s] {
+			mark = "*"
+		}
+		if s.Incomplete() {
+			name += " (incomplete)"
+		}
+		b.line(width, i == b.cursor, "%s%s %5.1f%% [%s] %s",
+			mark, fmtBytes(s.Total()), percent(s, b.dir), s.Type(), name)
+	}
+	b.out.WriteString(fmt.Sprintf("\x1b[%d;1H", page+3))
+	footer := "j/k/h/l move  t top  +/- threshold  a size"
+	if !b.readonly {
+		footer += "  space mark  d trash  D delete"
+	}
+	footer += "  q quit"
+	if b.message != "" {
+		footer = b.message
+	}
+	b.line(width, false, "%s", footer)
+	b.out.Flush()
+}
+
+// line writes a single line of the view, cut to the screen width.
+func (b *browser) line(width int, highlight bool, format string, args ...any) {
+	s := fmt.Sprintf(format, args...)
+	if r := []rune(s); len(r) > width {
+		s = string(r[:width])
+	}
+	if highlight {
+		s = "\x1b[7m" + s + strings.Repeat(" ", max(width-len([]rune(s)), 0)) + "\x1b[m"
+	}
+	// Raw mode does not translate newlines.
+	b.out.WriteString(s + "\r\n")
+}
+
+// percent returns the share of s in the total of dir.
+func percent(s, dir *scan.NodeStat) float64 {
+	if dir.Total() == 0 {
+		return 0
+	}
+	return 100 * float64(s.Total()) / float64(dir.Total())
+}
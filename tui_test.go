@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rollcat/dua/scan"
+)
+
+// find returns the entry at path under s, or nil.
+func find(s *scan.NodeStat, path string) *scan.NodeStat {
+	if s.Path() == path {
+		return s
+	}
+	for _, child := range s.Children() {
+		if found := find(child, path); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func TestRemovableFollowed(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	outside := filepath.Join(dir, "outside")
+	for _, d := range []string{filepath.Join(root, "dir"), outside} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{filepath.Join(root, "dir", "x"), filepath.Join(outside, "x")} {
+		if err := os.WriteFile(f, []byte("data"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("../outside", filepath.Join(root, "link")); err != nil {
+		t.Skip(err)
+	}
+	scanner, err := scan.NewScanner(scan.Options{Follow: scan.FollowAll})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := scanner.Scan(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &browser{root: result.Root}
+	for _, tt := range []struct {
+		path string
+		ok   bool
+	}{
+		{"dir/x", true},
+		{"dir", true},
+		{"link", false},
+		{"link/x", false},
+		{".", false},
+	} {
+		s := find(result.Root, filepath.Join(root, tt.path))
+		if s == nil {
+			t.Fatalf("%s not found", tt.path)
+		}
+		if err := b.removable(s); (err == nil) != tt.ok {
+			t.Errorf("removable(%s) = %v, want ok = %v", tt.path, err, tt.ok)
+		}
+	}
+}
+
+func TestRemoveLeavesRemovedDir(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "p", "q"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "p", "q", "x"), []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	scanner, err := scan.NewScanner(scan.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := scanner.Scan(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := find(result.Root, filepath.Join(root, "p"))
+	q := find(result.Root, filepath.Join(root, "p", "q"))
+	b := &browser{root: result.Root, marked: map[*scan.NodeStat]bool{p: true}}
+	b.showChildren(q, nil)
+	b.remove("Remove %d entries (%s)?", func(string) error { return nil })
+	if b.confirm == nil {
+		t.Fatalf("removal not offered: %s", b.message)
+	}
+	b.confirm()
+	if b.dir != result.Root {
+		t.Errorf("showing %s after removing %s, want %s", b.dir.Path(), p.Path(), root)
+	}
+	if len(result.Root.Children()) != 0 {
+		t.Errorf("%s still has %d children", root, len(result.Root.Children()))
+	}
+}